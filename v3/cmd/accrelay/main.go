@@ -0,0 +1,71 @@
+// Command accrelay holds a single connection to the ACC broadcasting interface and relays it to any number of
+// broadcasting clients, see package relay.
+//
+// The clients connect to the relay as if it were ACC, e.g. on a spectator PC on the LAN:
+//
+//	accrelay -acc 127.0.0.1:9000 -password asd -command-password cmd -listen 0.0.0.0:9001 -client-password lan
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/relay"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	accAddress := flag.String("acc", "127.0.0.1:9000", "address of the ACC broadcasting interface")
+	displayName := flag.String("name", "accrelay", "name shown in ACC for the connection of the relay")
+	password := flag.String("password", "", "connection password of ACC")
+	commandPassword := flag.String("command-password", "", "command password of ACC, needed to forward commands")
+	interval := flag.Int("interval", 250, "realtime-update interval in ms for all clients")
+	timeout := flag.Int("timeout", 5000, "timeout in ms after which the connection to ACC is considered broken")
+	listen := flag.String("listen", "0.0.0.0:9001", "address the clients connect to")
+	clientPassword := flag.String("client-password", "", "connection password the clients need to send")
+	clientCommandPassword := flag.String("client-command-password", "", "command password the clients need to send for their commands to be forwarded")
+	clientTimeout := flag.Duration("client-timeout", 0, "time after which a client that did not send anything is removed, 0 to only remove clients when they unregister")
+	debug := flag.Bool("debug", false, "enable debug logging")
+	flag.Parse()
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true, TimeFormat: zerolog.TimeFieldFormat})
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if *debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	r := relay.Relay{
+		Logger:             log.Logger,
+		ConnectionPassword: *clientPassword,
+		CommandPassword:    *clientCommandPassword,
+		ClientTimeout:      *clientTimeout,
+	}
+	if err := r.Listen(*listen); err != nil {
+		log.Fatal().Msgf("Could not listen on %s: %v", *listen, err)
+	}
+	log.Info().Msgf("Relaying %s on %s", *accAddress, r.Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	err := r.Run(ctx, network.Config{
+		Address:                  *accAddress,
+		DisplayName:              *displayName,
+		ConnectionPassword:       *password,
+		CommandPassword:          *commandPassword,
+		RealtimeUpdateIntervalMs: int32(*interval),
+		TimeoutMs:                int32(*timeout),
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal().Msgf("Relay stopped: %v", err)
+	}
+}
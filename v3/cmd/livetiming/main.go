@@ -0,0 +1,95 @@
+// Command livetiming connects to the ACC broadcasting interface and serves live timing over HTTP, such that
+// dashboards in a browser can show the timing without each of them registering with ACC.
+//
+// The following JSON is served:
+//
+//	GET /session        track, session type and phase, weather and the latest RealTimeUpdate
+//	GET /cars           every car of the entry-list with its latest RealTimeCarUpdate
+//	GET /leaderboard    the standings including the gaps between the cars
+//	GET /laps/{carId}   the laps completed by the car in the current session
+//	GET /ws             WebSocket pushing a snapshot at connection, followed by the deltas at the push rate
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	accAddress := flag.String("acc", "127.0.0.1:9000", "address of the ACC broadcasting interface")
+	displayName := flag.String("name", "livetiming", "name shown in ACC for this connection")
+	password := flag.String("password", "", "connection password of ACC")
+	interval := flag.Int("interval", 250, "realtime-update interval in ms requested from ACC")
+	timeout := flag.Int("timeout", 5000, "timeout in ms after which the connection to ACC is considered broken")
+	listen := flag.String("http", ":8080", "address to serve HTTP on")
+	pushRate := flag.Duration("push", 500*time.Millisecond, "interval at which deltas are pushed to the WebSocket clients")
+	debug := flag.Bool("debug", false, "enable debug logging")
+	flag.Parse()
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true, TimeFormat: zerolog.TimeFieldFormat})
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if *debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+	if *pushRate <= 0 {
+		log.Fatal().Msgf("Push rate needs to be positive, got %v", *pushRate)
+	}
+
+	client := &network.Client{Logger: log.Logger, GateOnEntryList: true}
+	server := newServer(client, log.Logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	httpServer := &http.Server{Addr: *listen, Handler: server.handler()}
+	go func() {
+		log.Info().Msgf("Serving live timing on %s", *listen)
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Error().Msgf("HTTP server stopped: %v", err)
+			cancel()
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(*pushRate)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				server.push()
+			}
+		}
+	}()
+
+	supervisor := network.Supervisor{Client: client}
+	err := supervisor.Run(ctx, network.Config{
+		Address:                  *accAddress,
+		DisplayName:              *displayName,
+		ConnectionPassword:       *password,
+		RealtimeUpdateIntervalMs: int32(*interval),
+		TimeoutMs:                int32(*timeout),
+	})
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	httpServer.Shutdown(shutdownCtx)
+	server.close()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal().Msgf("Live timing stopped: %v", err)
+	}
+}
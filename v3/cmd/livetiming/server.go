@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// subscriberBufferSize is the number of messages that can be pending for a WebSocket client. A client that
+// falls further behind is disconnected, as it would otherwise miss deltas. It can reconnect to start over.
+const subscriberBufferSize = 16
+
+// sessionInfo is served on /session
+type sessionInfo struct {
+	Track    network.TrackData
+	HasTrack bool
+
+	SessionIndex uint16
+	SessionType  byte // see network.SessionType<name> constants
+	Phase        byte // see network.SessionPhase<name> constants
+	Weather      state.Weather
+	Update       network.RealTimeUpdate
+}
+
+// standing is served on /leaderboard
+type standing struct {
+	state.Standing
+	GapText      string // see state.Standing.GapString
+	IntervalText string // see state.Standing.IntervalString
+}
+
+// carLaps is served on /laps/{carId}
+type carLaps struct {
+	CarId             uint16
+	Laps              []state.Lap
+	BestLapMs         int32 // 0 if no valid lap was driven yet
+	TheoreticalBestMs int32 // 0 if not every sector was driven validly yet
+}
+
+// message is pushed to the WebSocket clients. A client first receives a "snapshot" containing the session, all cars
+// and the leaderboard, followed by "delta"s containing only what changed since the previous message.
+type message struct {
+	Type        string
+	Session     json.RawMessage `json:",omitempty"`
+	Cars        []carDelta      `json:",omitempty"`
+	RemovedCars []uint16        `json:",omitempty"`
+	Leaderboard json.RawMessage `json:",omitempty"`
+	Laps        []state.Lap     `json:",omitempty"` // laps completed since the previous message
+}
+
+// carDelta only contains the Entry and/or Update of the car if these changed
+type carDelta struct {
+	Id     uint16
+	Entry  json.RawMessage `json:",omitempty"`
+	Update json.RawMessage `json:",omitempty"`
+}
+
+// pushed is the state that was pushed last, encoded to detect changes
+type pushed struct {
+	session     []byte
+	entries     map[uint16][]byte
+	updates     map[uint16][]byte
+	leaderboard []byte
+}
+
+// server serves the state of the session over HTTP and pushes deltas to WebSocket clients
+type server struct {
+	logger      zerolog.Logger
+	session     *state.Session
+	leaderboard *state.Leaderboard
+	laps        *state.LapTracker
+
+	mutex         sync.Mutex
+	subscribers   map[*websocket]chan []byte
+	last          *pushed
+	completedLaps []state.Lap
+}
+
+// newServer attaches the state that is served to the client
+func newServer(client *network.Client, logger zerolog.Logger) *server {
+	server := &server{
+		logger:      logger,
+		session:     state.NewSession(client),
+		leaderboard: state.NewLeaderboard(client),
+		laps:        state.NewLapTracker(client),
+		subscribers: make(map[*websocket]chan []byte),
+	}
+	server.laps.OnLapCompleted = func(lap state.Lap) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		if len(server.subscribers) > 0 {
+			server.completedLaps = append(server.completedLaps, lap)
+		}
+	}
+
+	// the session removes the cars when a new session starts, thus their entries are requested again
+	previous := client.OnRealTimeUpdate
+	hasUpdate, sessionIndex := false, uint16(0)
+	client.OnRealTimeUpdate = func(update network.RealTimeUpdate) {
+		if previous != nil {
+			previous(update)
+		}
+		if hasUpdate && update.SessionIndex != sessionIndex {
+			if err := client.RequestEntryList(); err != nil {
+				logger.Warn().Msgf("Could not request the entry-list of the new session: %v", err)
+			}
+		}
+		hasUpdate, sessionIndex = true, update.SessionIndex
+	}
+	return server
+}
+
+func (server *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session", server.handleSession)
+	mux.HandleFunc("/cars", server.handleCars)
+	mux.HandleFunc("/leaderboard", server.handleLeaderboard)
+	mux.HandleFunc("/laps/", server.handleLaps)
+	mux.HandleFunc("/ws", server.handleWebsocket)
+	return mux
+}
+
+func (server *server) sessionInfo(snapshot state.Snapshot) sessionInfo {
+	return sessionInfo{
+		Track:        snapshot.Track,
+		HasTrack:     snapshot.HasTrack,
+		SessionIndex: snapshot.SessionIndex,
+		SessionType:  snapshot.SessionType,
+		Phase:        snapshot.Phase,
+		Weather:      snapshot.Weather,
+		Update:       snapshot.Update,
+	}
+}
+
+func (server *server) standings() []standing {
+	standings := server.leaderboard.Standings()
+	result := make([]standing, len(standings))
+	for i, s := range standings {
+		result[i] = standing{Standing: s, GapText: s.GapString(), IntervalText: s.IntervalString()}
+	}
+	return result
+}
+
+func (server *server) handleSession(w http.ResponseWriter, r *http.Request) {
+	server.writeJSON(w, r, server.sessionInfo(server.session.Snapshot()))
+}
+
+func (server *server) handleCars(w http.ResponseWriter, r *http.Request) {
+	server.writeJSON(w, r, server.session.Snapshot().Cars)
+}
+
+func (server *server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	server.writeJSON(w, r, server.standings())
+}
+
+func (server *server) handleLaps(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/laps/"), 10, 16)
+	if err != nil {
+		http.Error(w, "invalid car id", http.StatusBadRequest)
+		return
+	}
+	carId := uint16(id)
+	if _, found := server.session.Car(carId); !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	laps := carLaps{CarId: carId, Laps: server.laps.Laps(carId)}
+	if best, ok := server.laps.BestLap(carId); ok {
+		laps.BestLapMs = best.LapTimeMs
+	}
+	laps.TheoreticalBestMs, _ = server.laps.TheoreticalBest(carId)
+	server.writeJSON(w, r, laps)
+}
+
+func (server *server) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		server.logger.Error().Msgf("Error while marshaling %s: %v", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(raw)
+}
+
+func (server *server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebsocket(w, r)
+	if err != nil {
+		server.logger.Warn().Msgf("WebSocket from %s refused: %v", r.RemoteAddr, err)
+		return
+	}
+	server.logger.Info().Msgf("WebSocket client %s connected", r.RemoteAddr)
+
+	// the snapshot is the state the next delta is based on
+	messages := make(chan []byte, subscriberBufferSize)
+	server.mutex.Lock()
+	if server.last == nil {
+		server.last = server.current()
+	}
+	snapshot, err := json.Marshal(server.last.delta(nil))
+	if err == nil {
+		messages <- snapshot
+		server.subscribers[ws] = messages
+	}
+	server.mutex.Unlock()
+	if err != nil {
+		server.logger.Error().Msgf("Error while marshaling snapshot: %v", err)
+		ws.Close()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		err := ws.ReadLoop()
+		server.logger.Info().Msgf("WebSocket client %s disconnected: %v", r.RemoteAddr, err)
+		server.unsubscribe(ws)
+		close(done)
+	}()
+
+	for message := range messages {
+		if err := ws.WriteText(message); err != nil {
+			server.logger.Warn().Msgf("Could not write to WebSocket client %s: %v", r.RemoteAddr, err)
+			break
+		}
+	}
+	ws.Close()
+	server.unsubscribe(ws)
+	<-done
+}
+
+func (server *server) unsubscribe(ws *websocket) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if messages, found := server.subscribers[ws]; found {
+		close(messages)
+		delete(server.subscribers, ws)
+	}
+}
+
+// push sends what changed since the previous push to all WebSocket clients
+func (server *server) push() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.subscribers) == 0 {
+		server.last = nil
+		return
+	}
+
+	current := server.current()
+	delta := current.delta(server.last)
+	delta.Laps, server.completedLaps = server.completedLaps, nil
+	server.last = current
+	if delta.Session == nil && delta.Cars == nil && delta.RemovedCars == nil && delta.Leaderboard == nil && delta.Laps == nil {
+		return
+	}
+
+	raw, err := json.Marshal(delta)
+	if err != nil {
+		server.logger.Error().Msgf("Error while marshaling delta: %v", err)
+		return
+	}
+	for ws, messages := range server.subscribers {
+		select {
+		case messages <- raw:
+		default:
+			server.logger.Warn().Msgf("Disconnecting WebSocket client %s that is falling behind", ws.conn.RemoteAddr())
+			close(messages)
+			delete(server.subscribers, ws)
+		}
+	}
+}
+
+// current encodes the current state
+func (server *server) current() *pushed {
+	snapshot := server.session.Snapshot()
+	current := &pushed{
+		entries: make(map[uint16][]byte, len(snapshot.Cars)),
+		updates: make(map[uint16][]byte, len(snapshot.Cars)),
+	}
+	current.session = server.marshal(server.sessionInfo(snapshot))
+	for _, car := range snapshot.Cars {
+		if car.HasEntry {
+			current.entries[car.Id] = server.marshal(car.Entry)
+		}
+		if car.HasUpdate {
+			current.updates[car.Id] = server.marshal(car.Update)
+		}
+	}
+	current.leaderboard = server.marshal(server.standings())
+	return current
+}
+
+func (server *server) marshal(v interface{}) []byte {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		server.logger.Error().Msgf("Error while marshaling %T: %v", v, err)
+		return nil
+	}
+	return raw
+}
+
+// ids returns the ids of all cars, sorted
+func (p *pushed) ids() []uint16 {
+	ids := make([]uint16, 0, len(p.entries)+len(p.updates))
+	for id := range p.entries {
+		ids = append(ids, id)
+	}
+	for id := range p.updates {
+		if _, found := p.entries[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (p *pushed) hasCar(id uint16) bool {
+	_, hasEntry := p.entries[id]
+	_, hasUpdate := p.updates[id]
+	return hasEntry || hasUpdate
+}
+
+// delta returns the message containing what changed compared to the previous state,
+// or a snapshot containing everything if there is no previous state
+func (p *pushed) delta(previous *pushed) message {
+	delta := message{Type: "delta"}
+	if previous == nil {
+		delta.Type = "snapshot"
+		previous = &pushed{}
+	}
+
+	if !bytes.Equal(p.session, previous.session) {
+		delta.Session = p.session
+	}
+	if !bytes.Equal(p.leaderboard, previous.leaderboard) {
+		delta.Leaderboard = p.leaderboard
+	}
+	for _, id := range p.ids() {
+		car := carDelta{Id: id}
+		if entry := p.entries[id]; !bytes.Equal(entry, previous.entries[id]) {
+			car.Entry = entry
+		}
+		if update := p.updates[id]; !bytes.Equal(update, previous.updates[id]) {
+			car.Update = update
+		}
+		if car.Entry != nil || car.Update != nil {
+			delta.Cars = append(delta.Cars, car)
+		}
+	}
+	for _, id := range previous.ids() {
+		if !p.hasCar(id) {
+			delta.RemovedCars = append(delta.RemovedCars, id)
+		}
+	}
+	return delta
+}
+
+// close disconnects all WebSocket clients
+func (server *server) close() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for ws, messages := range server.subscribers {
+		close(messages)
+		delete(server.subscribers, ws)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network/acctest"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feed calls the callbacks of the client as if the messages were received from ACC
+func feed(client *network.Client) {
+	client.OnTrackData(network.TrackData{Name: network.TrackNameSpa, Id: network.TrackIdSpa, Meters: 7004})
+	client.OnEntryList(network.EntryList{1, 2})
+	client.OnEntryListCar(network.EntryListCar{Id: 1, RaceNumber: 7, Drivers: []network.Driver{{ShortName: "ADR"}}})
+	client.OnEntryListCar(network.EntryListCar{Id: 2, RaceNumber: 12, Drivers: []network.Driver{{ShortName: "BDR"}}})
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionType: network.SessionTypeRace, Phase: network.SessionPhaseSession, SessionTime: 60000})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 1, Position: 1, Laps: 2, SplinePosition: 0.5, Kmh: 200})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 2, Position: 2, Laps: 2, SplinePosition: 0.4, Kmh: 200})
+}
+
+func get(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("invalid JSON from %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestREST(t *testing.T) {
+	var client network.Client
+	server := newServer(&client, zerolog.Nop())
+	feed(&client)
+	httpServer := httptest.NewServer(server.handler())
+	defer httpServer.Close()
+
+	var session sessionInfo
+	get(t, httpServer.URL+"/session", &session)
+	if session.Track.Name != network.TrackNameSpa || session.SessionType != network.SessionTypeRace {
+		t.Errorf("unexpected session %+v", session)
+	}
+
+	var cars []struct {
+		Id    uint16
+		Entry network.EntryListCar
+	}
+	get(t, httpServer.URL+"/cars", &cars)
+	if len(cars) != 2 || cars[1].Entry.RaceNumber != 12 {
+		t.Errorf("unexpected cars %+v", cars)
+	}
+
+	var leaderboard []standing
+	get(t, httpServer.URL+"/leaderboard", &leaderboard)
+	if len(leaderboard) != 2 || leaderboard[0].CarId != 1 || leaderboard[1].GapText == "" {
+		t.Errorf("unexpected leaderboard %+v", leaderboard)
+	}
+
+	var laps carLaps
+	if status := get(t, httpServer.URL+"/laps/2", &laps); status != http.StatusOK || laps.CarId != 2 {
+		t.Errorf("unexpected laps %+v (status %d)", laps, status)
+	}
+	if status := get(t, httpServer.URL+"/laps/9", &laps); status != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown car, got %d", status)
+	}
+	if status := get(t, httpServer.URL+"/laps/x", &laps); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid car id, got %d", status)
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	acc := &acctest.Server{
+		ConnectionPassword: "asd",
+		EntryList:          []network.EntryListCar{{Id: 1, RaceNumber: 7}},
+		Frames: []acctest.Frame{
+			{RealTimeUpdate: network.RealTimeUpdate{SessionIndex: 0}},
+			{RealTimeUpdate: network.RealTimeUpdate{SessionIndex: 0}},
+			{RealTimeUpdate: network.RealTimeUpdate{SessionIndex: 1}},
+		},
+	}
+	if err := acc.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	defer acc.Close()
+
+	client := &network.Client{}
+	server := newServer(client, zerolog.Nop())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(ctx, network.Config{Address: acc.Addr(), ConnectionPassword: "asd", RealtimeUpdateIntervalMs: 20, TimeoutMs: 500})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the entry-list is requested again, such that the cars of the new session get their entry
+	if _, ok := acc.WaitForCommand(network.RequestEntryList, 1, 2*time.Second); !ok {
+		t.Fatal("entry-list not requested when the session changed")
+	}
+	start := time.Now()
+	for {
+		if car, found := server.session.Car(1); found && car.HasEntry {
+			break
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("entry of the new session not received")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// readFrame reads an unmasked frame as send by the server
+func readFrame(t *testing.T, reader *bufio.Reader) (opcode byte, payload []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("could not read frame: %v", err)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("could not read payload: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func readMessage(t *testing.T, reader *bufio.Reader) message {
+	opcode, payload := readFrame(t, reader)
+	if opcode != opText {
+		t.Fatalf("expected text frame, got opcode %d", opcode)
+	}
+	var m message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	return m
+}
+
+func TestWebsocket(t *testing.T) {
+	if accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept %s", accept)
+	}
+
+	var client network.Client
+	server := newServer(&client, zerolog.Nop())
+	feed(&client)
+	httpServer := httptest.NewServer(server.handler())
+	defer httpServer.Close()
+	defer server.close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(httpServer.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	snapshot := readMessage(t, reader)
+	if snapshot.Type != "snapshot" || snapshot.Session == nil || snapshot.Leaderboard == nil || len(snapshot.Cars) != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	// only the update of the car that changed is pushed
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 2, Position: 2, Laps: 2, SplinePosition: 0.45, Kmh: 200})
+	server.push()
+	delta := readMessage(t, reader)
+	if delta.Type != "delta" || delta.Session != nil || len(delta.Cars) != 1 || delta.Cars[0].Id != 2 ||
+		delta.Cars[0].Entry != nil || delta.Cars[0].Update == nil {
+		t.Errorf("unexpected delta %+v", delta)
+	}
+
+	// nothing changed, nothing is pushed, a ping is answered
+	server.push()
+	conn.Write([]byte{0x80 | opPing, 0x80 | 2, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2})
+	if opcode, payload := readFrame(t, reader); opcode != opPong || string(payload) != "hi" {
+		t.Errorf("expected pong, got opcode %d with %q", opcode, payload)
+	}
+
+	// closing is acknowledged and the client is removed
+	conn.Write([]byte{0x80 | opClose, 0x80, 1, 2, 3, 4})
+	if opcode, _ := readFrame(t, reader); opcode != opClose {
+		t.Errorf("expected close, got opcode %d", opcode)
+	}
+	start := time.Now()
+	for {
+		server.mutex.Lock()
+		subscribers := len(server.subscribers)
+		server.mutex.Unlock()
+		if subscribers == 0 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("client not removed after closing")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Only the part of the WebSocket protocol (RFC 6455) needed to push text messages to browsers is implemented:
+// messages received from the browser are discarded, apart from the control frames.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// maxControlPayload is the maximum payload of a control frame as defined by the RFC
+const maxControlPayload = 125
+
+const websocketWriteTimeout = 5 * time.Second
+
+// websocket is a connection upgraded from an HTTP request
+type websocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+}
+
+func websocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header[name] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebsocket performs the opening handshake. If it fails, the error is already reported to the client.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("connection can not be hijacked")
+	}
+
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	ws := &websocket{conn: conn, reader: buffer.Reader}
+	conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// WriteText sends the message in a single text frame
+func (ws *websocket) WriteText(message []byte) error {
+	return ws.writeFrame(opText, message)
+}
+
+// Close sends a close frame and closes the connection
+func (ws *websocket) Close() error {
+	ws.writeFrame(opClose, nil)
+	return ws.conn.Close()
+}
+
+func (ws *websocket) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // final fragment
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(payload)
+	return err
+}
+
+// ReadLoop reads the frames send by the client until the connection is closed, answering pings and closes.
+// Data frames are discarded.
+func (ws *websocket) ReadLoop() error {
+	var header [2]byte
+	for {
+		if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+			return err
+		}
+		opcode, masked := header[0]&0x0f, header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			var extended [2]byte
+			if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(extended[:]))
+		case 127:
+			var extended [8]byte
+			if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(extended[:])
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+				return err
+			}
+		}
+
+		if opcode < opClose {
+			if _, err := io.CopyN(ioutil.Discard, ws.reader, int64(length)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if length > maxControlPayload {
+			return errors.New("control frame too large")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(ws.reader, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch opcode {
+		case opClose:
+			ws.writeFrame(opClose, payload)
+			ws.conn.Close()
+			return io.EOF
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Package acctest provides a fake ACC broadcasting interface to test clients of the network package without
+// having ACC running.
+//
+// The Server answers registration, entry-list and track-data requests in the same way as ACC does and
+// streams the scripted Frames at the update interval that was requested at registration. All messages
+// that are received are recorded such that tests can verify which commands were send.
+package acctest
+
+import (
+	"bytes"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"net"
+	"sync"
+	"time"
+)
+
+// Frame is the data that is streamed to each registered client at every update interval
+type Frame struct {
+	RealTimeUpdate  network.RealTimeUpdate
+	CarUpdates      []network.RealTimeCarUpdate
+	BroadCastEvents []network.BroadCastEvent
+}
+
+// Command is a message that was received by the Server
+type Command struct {
+	Type     network.OutboundMessageTypes
+	From     string // address of the client that send the command
+	Datagram []byte // the complete message, including the message-type
+}
+
+// Server is a fake ACC broadcasting interface listening on UDP.
+//
+// The exported fields need to be set before calling Start and should not be modified afterwards.
+type Server struct {
+	// ConnectionPassword needs to match the password send at registration, otherwise the registration is refused
+	ConnectionPassword string
+
+	// CommandPassword needs to match the command-password send at registration, otherwise the connection is read-only
+	CommandPassword string
+
+	// EntryList contains the cars that are send when the entry-list is requested
+	EntryList []network.EntryListCar
+
+	// TrackData is send when the track-data is requested
+	TrackData network.TrackData
+
+	// Frames are send one by one at every update interval.
+	// Once all frames are send, the last frame is repeated (without its BroadCastEvents) with the session-time
+	// incremented by the update interval.
+	// If no frames are defined, only a RealTimeUpdate with an incrementing session-time is send.
+	Frames []Frame
+
+	conn *net.UDPConn
+
+	mutex            sync.Mutex
+	clients          map[string]*registeredClient
+	nextConnectionId int32
+	commands         []Command
+	commandRecvd     chan struct{} // closed and replaced whenever a command is recorded
+	muted            bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type registeredClient struct {
+	addr         *net.UDPAddr
+	connectionId int32
+	interval     time.Duration
+	stop         chan struct{}
+}
+
+// Start starts listening on a random UDP port on the loopback interface
+func (server *Server) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	server.clients = make(map[string]*registeredClient)
+	server.commandRecvd = make(chan struct{})
+	server.done = make(chan struct{})
+
+	server.wg.Add(1)
+	go server.serve()
+	return nil
+}
+
+// Addr returns the address to pass to the network.Client
+func (server *Server) Addr() string {
+	return server.conn.LocalAddr().String()
+}
+
+// Close stops streaming to all clients and stops listening
+func (server *Server) Close() error {
+	close(server.done)
+	err := server.conn.Close()
+	server.wg.Wait()
+	return err
+}
+
+// SetMuted simulates ACC not responding anymore (e.g. because it is paused in a menu or crashed).
+//
+// While muted, nothing is streamed and incoming messages are ignored and not recorded. Clients that were
+// registered before muting are forgotten, thus they need to register again once unmuted.
+func (server *Server) SetMuted(muted bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.muted = muted
+	if muted {
+		for key, client := range server.clients {
+			close(client.stop)
+			delete(server.clients, key)
+		}
+	}
+}
+
+// SetEntryList replaces the EntryList after Start, e.g. to simulate a car joining the session.
+// Clients only receive the new entry-list once they request it.
+func (server *Server) SetEntryList(entryList []network.EntryListCar) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.EntryList = entryList
+}
+
+// ClientCount returns the number of clients that are currently registered
+func (server *Server) ClientCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return len(server.clients)
+}
+
+// Commands returns all commands received so far, in order of arrival
+func (server *Server) Commands() []Command {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Command(nil), server.commands...)
+}
+
+// WaitForCommand waits until count commands of the given type are received and returns the last of these.
+// If they are not received within the timeout, ok is false.
+func (server *Server) WaitForCommand(msgType network.OutboundMessageTypes, count int, timeout time.Duration) (command Command, ok bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		server.mutex.Lock()
+		n := 0
+		for _, c := range server.commands {
+			if c.Type == msgType {
+				n++
+				command = c
+			}
+		}
+		recvd := server.commandRecvd
+		server.mutex.Unlock()
+
+		if n >= count {
+			return command, true
+		}
+
+		select {
+		case <-recvd:
+		case <-timer.C:
+			return Command{}, false
+		}
+	}
+}
+
+func (server *Server) serve() {
+	defer server.wg.Done()
+
+	var readArray [network.ReadBufferSize]byte
+	for {
+		n, addr, err := server.conn.ReadFromUDP(readArray[:])
+		if err != nil {
+			select {
+			case <-server.done:
+				server.stopAll()
+				return
+			default:
+				continue
+			}
+		}
+		if n == 0 {
+			continue
+		}
+
+		datagram := append([]byte(nil), readArray[:n]...)
+		server.handle(addr, datagram)
+	}
+}
+
+func (server *Server) handle(addr *net.UDPAddr, datagram []byte) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.muted {
+		return
+	}
+
+	server.commands = append(server.commands, Command{Type: datagram[0], From: addr.String(), Datagram: datagram})
+	close(server.commandRecvd)
+	server.commandRecvd = make(chan struct{})
+
+	readBuffer := bytes.NewBuffer(datagram[1:])
+	var writeBuffer bytes.Buffer
+	switch datagram[0] {
+	case network.RegisterCommandApplication:
+		_, _, connectionPassword, interval, commandPassword, ok := network.UnmarshalRegistrationReq(readBuffer)
+		if !ok {
+			return
+		}
+		if connectionPassword != server.ConnectionPassword {
+			network.MarshalConnectionResp(&writeBuffer, -1, 0, 0, "Wrong password")
+			server.conn.WriteToUDP(writeBuffer.Bytes(), addr)
+			return
+		}
+
+		if client, found := server.clients[addr.String()]; found {
+			close(client.stop)
+		}
+		client := &registeredClient{
+			addr:         addr,
+			connectionId: server.nextConnectionId,
+			interval:     time.Duration(interval) * time.Millisecond,
+			stop:         make(chan struct{}),
+		}
+		if client.interval <= 0 {
+			client.interval = time.Second
+		}
+		server.nextConnectionId++
+		server.clients[addr.String()] = client
+
+		var writable int8
+		if commandPassword == server.CommandPassword {
+			writable = 1
+		}
+		network.MarshalConnectionResp(&writeBuffer, client.connectionId, 1, writable, "")
+		server.conn.WriteToUDP(writeBuffer.Bytes(), addr)
+
+		server.wg.Add(1)
+		go server.stream(client)
+
+	case network.UnregisterCommandApplication:
+		if client, found := server.clients[addr.String()]; found {
+			close(client.stop)
+			delete(server.clients, addr.String())
+		}
+
+	case network.RequestEntryList:
+		connectionId, ok := network.UnmarshalEntryListReq(readBuffer)
+		if !ok {
+			return
+		}
+		entryList := make(network.EntryList, len(server.EntryList))
+		for i, car := range server.EntryList {
+			entryList[i] = car.Id
+		}
+		network.MarshalEntryListRep(&writeBuffer, connectionId, entryList)
+		server.conn.WriteToUDP(writeBuffer.Bytes(), addr)
+		for _, car := range server.EntryList {
+			writeBuffer.Reset()
+			network.MarshalEntryListCarResp(&writeBuffer, car)
+			server.conn.WriteToUDP(writeBuffer.Bytes(), addr)
+		}
+
+	case network.RequestTrackData:
+		connectionId, ok := network.UnmarshalTrackDataReq(readBuffer)
+		if !ok {
+			return
+		}
+		network.MarshalTrackDataResp(&writeBuffer, connectionId, server.TrackData)
+		server.conn.WriteToUDP(writeBuffer.Bytes(), addr)
+	}
+}
+
+func (server *Server) stream(client *registeredClient) {
+	defer server.wg.Done()
+
+	ticker := time.NewTicker(client.interval)
+	defer ticker.Stop()
+
+	var writeBuffer bytes.Buffer
+	for i := 0; ; i++ {
+		select {
+		case <-client.stop:
+			return
+		case <-server.done:
+			return
+		case <-ticker.C:
+		}
+
+		frame := server.frame(i, client.interval)
+
+		writeBuffer.Reset()
+		network.MarshalRealTimeUpdate(&writeBuffer, frame.RealTimeUpdate)
+		server.conn.WriteToUDP(writeBuffer.Bytes(), client.addr)
+		for _, carUpdate := range frame.CarUpdates {
+			writeBuffer.Reset()
+			network.MarshalCarUpdateResp(&writeBuffer, carUpdate)
+			server.conn.WriteToUDP(writeBuffer.Bytes(), client.addr)
+		}
+		for _, event := range frame.BroadCastEvents {
+			writeBuffer.Reset()
+			network.MarshalBroadCastEvent(&writeBuffer, event)
+			server.conn.WriteToUDP(writeBuffer.Bytes(), client.addr)
+		}
+	}
+}
+
+// frame returns the i-th frame to stream
+func (server *Server) frame(i int, interval time.Duration) Frame {
+	intervalMs := float32(interval / time.Millisecond)
+	if len(server.Frames) == 0 {
+		return Frame{RealTimeUpdate: network.RealTimeUpdate{SessionTime: float32(i) * intervalMs}}
+	}
+	if i < len(server.Frames) {
+		return server.Frames[i]
+	}
+
+	frame := server.Frames[len(server.Frames)-1]
+	frame.BroadCastEvents = nil
+	frame.RealTimeUpdate.SessionTime += float32(i-len(server.Frames)+1) * intervalMs
+	return frame
+}
+
+func (server *Server) stopAll() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for key, client := range server.clients {
+		close(client.stop)
+		delete(server.clients, key)
+	}
+}
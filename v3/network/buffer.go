@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"github.com/rs/zerolog/log"
+	"sort"
 )
 
 type OutboundMessageTypes = byte
@@ -13,9 +14,9 @@ const (
 	UnregisterCommandApplication OutboundMessageTypes = 9
 	RequestEntryList             OutboundMessageTypes = 10
 	RequestTrackData             OutboundMessageTypes = 11
-	// CHANGE_HUD_PAGE                OutboundMessageTypes = 49
-	// CHANGE_FOCUS                   OutboundMessageTypes = 50
-	// INSTANT_REPLAY_REQUEST         OutboundMessageTypes = 51
+	ChangeHUDPage                OutboundMessageTypes = 49
+	ChangeFocus                  OutboundMessageTypes = 50
+	InstantReplayRequest         OutboundMessageTypes = 51
 )
 
 type InboundMessageTypes = byte
@@ -199,6 +200,25 @@ const (
 	NationalityWales           = 77
 )
 
+// The HUD pages that can be shown in ACC, as reported in RealTimeUpdate.CurrentHUDPage
+const (
+	HUDPageBlank        = "Blank"
+	HUDPageBasicHUD     = "Basic HUD"
+	HUDPageHelp         = "Help"
+	HUDPageTimeTable    = "TimeTable"
+	HUDPageBroadcasting = "Broadcasting"
+	HUDPageTrackMap     = "TrackMap"
+)
+
+// IsKnownHUDPage returns true if the page is one of the constants HUDPage<name>
+func IsKnownHUDPage(page string) bool {
+	switch page {
+	case HUDPageBlank, HUDPageBasicHUD, HUDPageHelp, HUDPageTimeTable, HUDPageBroadcasting, HUDPageTrackMap:
+		return true
+	}
+	return false
+}
+
 const InvalidSectorTime = (2 << 30) - 1
 
 // EntryList provides an array of internal id's of each car in the session
@@ -222,9 +242,11 @@ type EntryListCar struct {
 
 // Note that the track-data is not resend when a new session starts
 type TrackData struct {
-	Name   string // Will be equal to one of the constants TrackName<name>
-	Id     int32  // Will be equal to one of the constants TrackId<name>
-	Meters int32
+	Name       string // Will be equal to one of the constants TrackName<name>
+	Id         int32  // Will be equal to one of the constants TrackId<name>
+	Meters     int32
+	CameraSets map[string][]string // cameras available in each camera-set, to be used in Client.RequestFocus
+	HUDPages   []string            // HUD pages available, to be used in Client.RequestHUDPage
 }
 
 // RealTimeUpdate is the first data recv'd when connecting to the broadcasting-interface (AFAICT)
@@ -240,6 +262,8 @@ type RealTimeUpdate struct {
 	ActiveCamera    string
 	CurrentHUDPage  string
 	IsReplayPlaying byte    // yes is != 0x00
+	ReplayTime      float32 // session-time in ms that is currently shown in the replay, only set while IsReplayPlaying
+	ReplayRemaining float32 // ms remaining before the replay ends, only set while IsReplayPlaying
 	TimeOfDay       float32 // seconds since midnight (not coherent with SessionTime which is a float but expressing milliseconds instead of seconds), subject to race-time-multiplier
 	AmbientTemp     int8
 	TrackTemp       int8
@@ -269,7 +293,7 @@ type RealTimeCarUpdate struct {
 
 	// LastLap.LapTimeMs always provide the real lap-time of the last lap, also in case it is invalid
 	// LastLap.IsInvalid will signal if the lap is valid or not
-	// LastLap.Splits[x] can be 0 in case the sector was invalid (never equal to InvalidSectorTime)
+	// LastLap.Splits[x] is InvalidSectorTime in case the sector was invalid (see Lap.SplitTimes)
 	LastLap Lap
 
 	// The LapTimeMs is continuously updated during the lap.
@@ -291,7 +315,7 @@ const (
 type BroadCastEvent struct {
 	Type   byte   // BroadCastEventType<something>
 	Msg    string // message (laptime often)
-	TimeMs int32  // Beware, is not since the session started, seems to be since the connection to the broadcasting-interface was established
+	TimeMs int32  // Beware, is not since the session started, seems to be since the connection to the broadcasting-interface was established (see state.Clock)
 	CarId  int32  // !elsewhere this is uint16
 }
 
@@ -299,7 +323,7 @@ type Lap struct {
 	LapTimeMs      int32
 	CarId          uint16
 	DriverId       uint16
-	Splits         []int32
+	Splits         []int32 // InvalidSectorTime for an invalid sector, see SplitTimes for 0 instead
 	IsInvalid      byte
 	IsValidForBest byte
 	IsOutLap       byte
@@ -324,18 +348,140 @@ func MarshalRegistrationReq(buffer *bytes.Buffer, displayName string, connection
 	return ok
 }
 
+// UnmarshalRegistrationReq is the counterpart of MarshalRegistrationReq, to be used by a server implementing
+// the broadcasting interface. The message-type is expected to be consumed already.
+func UnmarshalRegistrationReq(buffer *bytes.Buffer) (protocolVersion byte, displayName string, connectionPassword string, msRealtimeUpdateInterval int32, commandPassword string, ok bool) {
+	ok = readBuffer(buffer, &protocolVersion)
+	ok = ok && readString(buffer, &displayName)
+	ok = ok && readString(buffer, &connectionPassword)
+	ok = ok && readBuffer(buffer, &msRealtimeUpdateInterval)
+	ok = ok && readString(buffer, &commandPassword)
+	return protocolVersion, displayName, connectionPassword, msRealtimeUpdateInterval, commandPassword, ok
+}
+
 func MarshalDisconnectReq(buffer *bytes.Buffer, connectionId int32) (ok bool) {
 	ok = writeByteBuffer(buffer, UnregisterCommandApplication)
 	ok = ok && writeBuffer(buffer, connectionId)
 	return ok
 }
 
-func UnmarshalConnectionResp(buffer *bytes.Buffer) (connectionId int32, connectionSuccess int8, isReadOnly int8, errMsg string, ok bool) {
+// UnmarshalDisconnectReq is the counterpart of MarshalDisconnectReq.
+// The message-type is expected to be consumed already.
+func UnmarshalDisconnectReq(buffer *bytes.Buffer) (connectionId int32, ok bool) {
+	ok = readBuffer(buffer, &connectionId)
+	return connectionId, ok
+}
+
+// MarshalFocusReq requests ACC to change the focused car and/or the camera.
+//
+// The focus only moves to another car if carId is not negative (the id on the wire is an uint16, the
+// signed type is only used to be able to express 'no change'). The camera only changes if both the
+// cameraSet and the camera are non-empty.
+func MarshalFocusReq(buffer *bytes.Buffer, connectionId int32, carId int32, cameraSet string, camera string) (ok bool) {
+	ok = writeByteBuffer(buffer, ChangeFocus)
+	ok = ok && writeBuffer(buffer, connectionId)
+	if carId < 0 {
+		ok = ok && writeByteBuffer(buffer, 0)
+	} else {
+		ok = ok && writeByteBuffer(buffer, 1)
+		ok = ok && writeBuffer(buffer, uint16(carId))
+	}
+	if cameraSet == "" || camera == "" {
+		ok = ok && writeByteBuffer(buffer, 0)
+	} else {
+		ok = ok && writeByteBuffer(buffer, 1)
+		ok = ok && writeString(buffer, cameraSet)
+		ok = ok && writeString(buffer, camera)
+	}
+	return ok
+}
+
+// UnmarshalFocusReq is the counterpart of MarshalFocusReq. The carId is negative if the focused car should not
+// change and cameraSet and camera are empty if the camera should not change.
+// The message-type is expected to be consumed already.
+func UnmarshalFocusReq(buffer *bytes.Buffer) (connectionId int32, carId int32, cameraSet string, camera string, ok bool) {
+	ok = readBuffer(buffer, &connectionId)
+	var hasCar, hasCamera byte
+	ok = ok && readBuffer(buffer, &hasCar)
+	carId = -1
+	if ok && hasCar != 0 {
+		var id uint16
+		ok = readBuffer(buffer, &id)
+		carId = int32(id)
+	}
+	ok = ok && readBuffer(buffer, &hasCamera)
+	if ok && hasCamera != 0 {
+		ok = readString(buffer, &cameraSet)
+		ok = ok && readString(buffer, &camera)
+	}
+	return connectionId, carId, cameraSet, camera, ok
+}
+
+// MarshalHUDPageReq requests ACC to show the given HUD page (see constants HUDPage<name>)
+func MarshalHUDPageReq(buffer *bytes.Buffer, connectionId int32, page string) (ok bool) {
+	ok = writeByteBuffer(buffer, ChangeHUDPage)
+	ok = ok && writeBuffer(buffer, connectionId)
+	ok = ok && writeString(buffer, page)
+	return ok
+}
+
+// UnmarshalHUDPageReq is the counterpart of MarshalHUDPageReq.
+// The message-type is expected to be consumed already.
+func UnmarshalHUDPageReq(buffer *bytes.Buffer) (connectionId int32, page string, ok bool) {
+	ok = readBuffer(buffer, &connectionId)
+	ok = ok && readString(buffer, &page)
+	return connectionId, page, ok
+}
+
+// MarshalInstantReplayReq requests ACC to start an instant replay.
+//
+// The replay starts at startSessionTimeMs (see RealTimeUpdate.SessionTime) and lasts for durationMs.
+// A negative carId keeps the currently focused car and empty camera names keep the active camera.
+func MarshalInstantReplayReq(buffer *bytes.Buffer, connectionId int32, startSessionTimeMs float32, durationMs float32, carId int32, cameraSet string, camera string) (ok bool) {
+	ok = writeByteBuffer(buffer, InstantReplayRequest)
+	ok = ok && writeBuffer(buffer, connectionId)
+	ok = ok && writeBuffer(buffer, startSessionTimeMs)
+	ok = ok && writeBuffer(buffer, durationMs)
+	ok = ok && writeBuffer(buffer, carId)
+	ok = ok && writeString(buffer, cameraSet)
+	ok = ok && writeString(buffer, camera)
+	return ok
+}
+
+// UnmarshalInstantReplayReq is the counterpart of MarshalInstantReplayReq.
+// The message-type is expected to be consumed already.
+func UnmarshalInstantReplayReq(buffer *bytes.Buffer) (connectionId int32, startSessionTimeMs float32, durationMs float32, carId int32, cameraSet string, camera string, ok bool) {
+	ok = readBuffer(buffer, &connectionId)
+	ok = ok && readBuffer(buffer, &startSessionTimeMs)
+	ok = ok && readBuffer(buffer, &durationMs)
+	ok = ok && readBuffer(buffer, &carId)
+	ok = ok && readString(buffer, &cameraSet)
+	ok = ok && readString(buffer, &camera)
+	return connectionId, startSessionTimeMs, durationMs, carId, cameraSet, camera, ok
+}
+
+// MarshalConnectionResp writes the registration-result as send by ACC in response to MarshalRegistrationReq
+func MarshalConnectionResp(buffer *bytes.Buffer, connectionId int32, connectionSuccess int8, isWritable int8, errMsg string) (ok bool) {
+	ok = writeByteBuffer(buffer, RegistrationResultMsgType)
+	ok = ok && writeBuffer(buffer, connectionId)
+	ok = ok && writeBuffer(buffer, connectionSuccess)
+	ok = ok && writeBuffer(buffer, isWritable)
+	ok = ok && writeString(buffer, errMsg)
+	return ok
+}
+
+// UnmarshalConnectionResp reads the registration-result.
+//
+// The registration is refused by ACC (e.g. due to a wrong connection-password) if connectionSuccess is 0, in
+// which case errMsg contains the reason. Beware that the byte following connectionSuccess is 0 if the connection
+// is read-only (the command-password was not correct) and thus is named isWritable (the C# SDK of Kunos reads
+// it as `isReadonly = ReadByte() == 0`).
+func UnmarshalConnectionResp(buffer *bytes.Buffer) (connectionId int32, connectionSuccess int8, isWritable int8, errMsg string, ok bool) {
 	ok = readBuffer(buffer, &connectionId)
 	ok = ok && readBuffer(buffer, &connectionSuccess)
-	ok = ok && readBuffer(buffer, &isReadOnly)
+	ok = ok && readBuffer(buffer, &isWritable)
 	ok = ok && readString(buffer, &errMsg)
-	return connectionId, connectionSuccess, isReadOnly, errMsg, ok
+	return connectionId, connectionSuccess, isWritable, errMsg, ok
 }
 
 func MarshalEntryListReq(buffer *bytes.Buffer, connectionId int32) bool {
@@ -344,6 +490,24 @@ func MarshalEntryListReq(buffer *bytes.Buffer, connectionId int32) bool {
 	return ok
 }
 
+// UnmarshalEntryListReq is the counterpart of MarshalEntryListReq.
+// The message-type is expected to be consumed already.
+func UnmarshalEntryListReq(buffer *bytes.Buffer) (connectionId int32, ok bool) {
+	ok = readBuffer(buffer, &connectionId)
+	return connectionId, ok
+}
+
+// MarshalEntryListRep writes the entry-list as send by ACC in response to MarshalEntryListReq
+func MarshalEntryListRep(buffer *bytes.Buffer, connectionId int32, entryList EntryList) (ok bool) {
+	ok = writeByteBuffer(buffer, EntryListMsgType)
+	ok = ok && writeBuffer(buffer, connectionId)
+	ok = ok && writeBuffer(buffer, uint16(len(entryList)))
+	for i := 0; ok && i < len(entryList); i++ {
+		ok = ok && writeBuffer(buffer, entryList[i])
+	}
+	return ok
+}
+
 func UnmarshalEntryListRep(buffer *bytes.Buffer) (connectionId int32, entryList EntryList, ok bool) {
 	ok = readBuffer(buffer, &connectionId)
 	var entryCount uint16
@@ -355,6 +519,28 @@ func UnmarshalEntryListRep(buffer *bytes.Buffer) (connectionId int32, entryList
 	return connectionId, entryList, ok
 }
 
+// MarshalEntryListCarResp writes the car as send by ACC for each car in the entry-list
+func MarshalEntryListCarResp(buffer *bytes.Buffer, car EntryListCar) (ok bool) {
+	ok = writeByteBuffer(buffer, EntryListCarMsgType)
+	ok = ok && writeBuffer(buffer, car.Id)
+	ok = ok && writeBuffer(buffer, car.Model)
+	ok = ok && writeString(buffer, car.TeamName)
+	ok = ok && writeBuffer(buffer, car.RaceNumber)
+	ok = ok && writeBuffer(buffer, car.CupCategory)
+	ok = ok && writeBuffer(buffer, car.CurrentDriverId)
+	ok = ok && writeBuffer(buffer, car.Nationality)
+
+	ok = ok && writeBuffer(buffer, uint8(len(car.Drivers)))
+	for i := 0; ok && i < len(car.Drivers); i++ {
+		ok = ok && writeString(buffer, car.Drivers[i].FirstName)
+		ok = ok && writeString(buffer, car.Drivers[i].LastName)
+		ok = ok && writeString(buffer, car.Drivers[i].ShortName)
+		ok = ok && writeBuffer(buffer, car.Drivers[i].Category)
+		ok = ok && writeBuffer(buffer, car.Drivers[i].Nationality)
+	}
+	return ok
+}
+
 func UnmarshalEntryListCarResp(buffer *bytes.Buffer) (car EntryListCar, ok bool) {
 	ok = readBuffer(buffer, &car.Id)
 	ok = ok && readBuffer(buffer, &car.Model)
@@ -383,15 +569,105 @@ func MarshalTrackDataReq(buffer *bytes.Buffer, connectionId int32) bool {
 	return ok
 }
 
+// UnmarshalTrackDataReq is the counterpart of MarshalTrackDataReq.
+// The message-type is expected to be consumed already.
+func UnmarshalTrackDataReq(buffer *bytes.Buffer) (connectionId int32, ok bool) {
+	ok = readBuffer(buffer, &connectionId)
+	return connectionId, ok
+}
+
+// MarshalTrackDataResp writes the track-data as send by ACC in response to MarshalTrackDataReq.
+//
+// The camera-sets are written in alphabetical order of their name, as to always result in the same message.
+func MarshalTrackDataResp(buffer *bytes.Buffer, connectionId int32, trackData TrackData) (ok bool) {
+	ok = writeByteBuffer(buffer, TrackDataMsgType)
+	ok = ok && writeBuffer(buffer, connectionId)
+	ok = ok && writeString(buffer, trackData.Name)
+	ok = ok && writeBuffer(buffer, trackData.Id)
+	ok = ok && writeBuffer(buffer, trackData.Meters)
+
+	cameraSetNames := make([]string, 0, len(trackData.CameraSets))
+	for name := range trackData.CameraSets {
+		cameraSetNames = append(cameraSetNames, name)
+	}
+	sort.Strings(cameraSetNames)
+	ok = ok && writeBuffer(buffer, uint8(len(cameraSetNames)))
+	for _, name := range cameraSetNames {
+		cameras := trackData.CameraSets[name]
+		ok = ok && writeString(buffer, name)
+		ok = ok && writeBuffer(buffer, uint8(len(cameras)))
+		for i := 0; ok && i < len(cameras); i++ {
+			ok = ok && writeString(buffer, cameras[i])
+		}
+	}
+
+	ok = ok && writeBuffer(buffer, uint8(len(trackData.HUDPages)))
+	for i := 0; ok && i < len(trackData.HUDPages); i++ {
+		ok = ok && writeString(buffer, trackData.HUDPages[i])
+	}
+	return ok
+}
+
 func UnmarshalTrackDataResp(buffer *bytes.Buffer) (connectionId int32, trackData TrackData, ok bool) {
 	ok = readBuffer(buffer, &connectionId)
-	ok = readString(buffer, &trackData.Name)
+	ok = ok && readString(buffer, &trackData.Name)
 	ok = ok && readBuffer(buffer, &trackData.Id)
 	ok = ok && readBuffer(buffer, &trackData.Meters)
+
+	var cameraSetCount uint8
+	ok = ok && readBuffer(buffer, &cameraSetCount)
+	trackData.CameraSets = make(map[string][]string, cameraSetCount)
+	for i := uint8(0); ok && i < cameraSetCount; i++ {
+		var cameraSetName string
+		ok = ok && readString(buffer, &cameraSetName)
+
+		var cameraCount uint8
+		ok = ok && readBuffer(buffer, &cameraCount)
+		cameras := make([]string, cameraCount)
+		for j := uint8(0); ok && j < cameraCount; j++ {
+			ok = ok && readString(buffer, &cameras[j])
+		}
+		trackData.CameraSets[cameraSetName] = cameras
+	}
+
+	var hudPageCount uint8
+	ok = ok && readBuffer(buffer, &hudPageCount)
+	trackData.HUDPages = make([]string, hudPageCount)
+	for i := uint8(0); ok && i < hudPageCount; i++ {
+		ok = ok && readString(buffer, &trackData.HUDPages[i])
+	}
 	return connectionId, trackData, ok
 }
 
-func unmarshalRealTimeUpdate(buffer *bytes.Buffer) (realTimeUpdate RealTimeUpdate, ok bool) {
+// MarshalRealTimeUpdate writes the update as send by ACC at every update-interval
+func MarshalRealTimeUpdate(buffer *bytes.Buffer, realTimeUpdate RealTimeUpdate) (ok bool) {
+	ok = writeByteBuffer(buffer, RealtimeUpdateMsgType)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.EventIndex)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.SessionIndex)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.SessionType)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.Phase)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.SessionTime)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.SessionEndTime)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.FocusedCarIndex)
+	ok = ok && writeString(buffer, realTimeUpdate.ActiveCameraSet)
+	ok = ok && writeString(buffer, realTimeUpdate.ActiveCamera)
+	ok = ok && writeString(buffer, realTimeUpdate.CurrentHUDPage)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.IsReplayPlaying)
+	if realTimeUpdate.IsReplayPlaying > 0 {
+		ok = ok && writeBuffer(buffer, realTimeUpdate.ReplayTime)
+		ok = ok && writeBuffer(buffer, realTimeUpdate.ReplayRemaining)
+	}
+	ok = ok && writeBuffer(buffer, realTimeUpdate.TimeOfDay)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.AmbientTemp)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.TrackTemp)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.Clouds)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.RainLevel)
+	ok = ok && writeBuffer(buffer, realTimeUpdate.Wettness)
+	ok = ok && MarshalLap(buffer, realTimeUpdate.BestSessionLap)
+	return ok
+}
+
+func UnmarshalRealTimeUpdate(buffer *bytes.Buffer) (realTimeUpdate RealTimeUpdate, ok bool) {
 	ok = readBuffer(buffer, &realTimeUpdate.EventIndex)
 	ok = ok && readBuffer(buffer, &realTimeUpdate.SessionIndex)
 	ok = ok && readBuffer(buffer, &realTimeUpdate.SessionType)
@@ -404,9 +680,8 @@ func unmarshalRealTimeUpdate(buffer *bytes.Buffer) (realTimeUpdate RealTimeUpdat
 	ok = ok && readString(buffer, &realTimeUpdate.CurrentHUDPage)
 	ok = ok && readBuffer(buffer, &realTimeUpdate.IsReplayPlaying)
 	if realTimeUpdate.IsReplayPlaying > 0 {
-		var tmp int32
-		ok = ok && readBuffer(buffer, &tmp)
-		ok = ok && readBuffer(buffer, &tmp)
+		ok = ok && readBuffer(buffer, &realTimeUpdate.ReplayTime)
+		ok = ok && readBuffer(buffer, &realTimeUpdate.ReplayRemaining)
 	}
 	ok = ok && readBuffer(buffer, &realTimeUpdate.TimeOfDay)
 	ok = ok && readBuffer(buffer, &realTimeUpdate.AmbientTemp)
@@ -415,11 +690,35 @@ func unmarshalRealTimeUpdate(buffer *bytes.Buffer) (realTimeUpdate RealTimeUpdat
 	ok = ok && readBuffer(buffer, &realTimeUpdate.RainLevel)
 	ok = ok && readBuffer(buffer, &realTimeUpdate.Wettness)
 	if ok {
-		realTimeUpdate.BestSessionLap, ok = unmarshalLap(buffer)
+		realTimeUpdate.BestSessionLap, ok = UnmarshalLap(buffer)
 	}
 	return realTimeUpdate, ok
 }
 
+// MarshalCarUpdateResp writes the update of a single car as send by ACC at every update-interval
+func MarshalCarUpdateResp(buffer *bytes.Buffer, carUpdate RealTimeCarUpdate) (ok bool) {
+	ok = writeByteBuffer(buffer, RealtimeCarUpdateMsgType)
+	ok = ok && writeBuffer(buffer, carUpdate.Id)
+	ok = ok && writeBuffer(buffer, carUpdate.DriverId)
+	ok = ok && writeBuffer(buffer, carUpdate.DriverCount)
+	ok = ok && writeBuffer(buffer, carUpdate.Gear)
+	ok = ok && writeBuffer(buffer, carUpdate.WorldPosX)
+	ok = ok && writeBuffer(buffer, carUpdate.WorldPosY)
+	ok = ok && writeBuffer(buffer, carUpdate.Yaw)
+	ok = ok && writeBuffer(buffer, carUpdate.CarLocation)
+	ok = ok && writeBuffer(buffer, carUpdate.Kmh)
+	ok = ok && writeBuffer(buffer, carUpdate.Position)
+	ok = ok && writeBuffer(buffer, carUpdate.CupPosition)
+	ok = ok && writeBuffer(buffer, carUpdate.TrackPosition)
+	ok = ok && writeBuffer(buffer, carUpdate.SplinePosition)
+	ok = ok && writeBuffer(buffer, carUpdate.Laps)
+	ok = ok && writeBuffer(buffer, carUpdate.Delta)
+	ok = ok && MarshalLap(buffer, carUpdate.BestSessionLap)
+	ok = ok && MarshalLap(buffer, carUpdate.LastLap)
+	ok = ok && MarshalLap(buffer, carUpdate.CurrentLap)
+	return ok
+}
+
 func UnmarshalCarUpdateResp(buffer *bytes.Buffer) (carUpdate RealTimeCarUpdate, ok bool) {
 	ok = readBuffer(buffer, &carUpdate.Id)
 	ok = ok && readBuffer(buffer, &carUpdate.DriverId)
@@ -437,18 +736,28 @@ func UnmarshalCarUpdateResp(buffer *bytes.Buffer) (carUpdate RealTimeCarUpdate,
 	ok = ok && readBuffer(buffer, &carUpdate.Laps)
 	ok = ok && readBuffer(buffer, &carUpdate.Delta)
 	if ok {
-		carUpdate.BestSessionLap, ok = unmarshalLap(buffer)
+		carUpdate.BestSessionLap, ok = UnmarshalLap(buffer)
 	}
 	if ok {
-		carUpdate.LastLap, ok = unmarshalLap(buffer)
+		carUpdate.LastLap, ok = UnmarshalLap(buffer)
 	}
 	if ok {
-		carUpdate.CurrentLap, ok = unmarshalLap(buffer)
+		carUpdate.CurrentLap, ok = UnmarshalLap(buffer)
 	}
 	return carUpdate, ok
 }
 
-func unmarshalBroadCastEvent(buffer *bytes.Buffer) (broadCastEvent BroadCastEvent, ok bool) {
+// MarshalBroadCastEvent writes the event as send by ACC
+func MarshalBroadCastEvent(buffer *bytes.Buffer, broadCastEvent BroadCastEvent) (ok bool) {
+	ok = writeByteBuffer(buffer, BroadcastingEventMsgType)
+	ok = ok && writeBuffer(buffer, broadCastEvent.Type)
+	ok = ok && writeString(buffer, broadCastEvent.Msg)
+	ok = ok && writeBuffer(buffer, broadCastEvent.TimeMs)
+	ok = ok && writeBuffer(buffer, broadCastEvent.CarId)
+	return ok
+}
+
+func UnmarshalBroadCastEvent(buffer *bytes.Buffer) (broadCastEvent BroadCastEvent, ok bool) {
 	ok = readBuffer(buffer, &broadCastEvent.Type)
 	ok = ok && readString(buffer, &broadCastEvent.Msg)
 	ok = ok && readBuffer(buffer, &broadCastEvent.TimeMs)
@@ -456,7 +765,27 @@ func unmarshalBroadCastEvent(buffer *bytes.Buffer) (broadCastEvent BroadCastEven
 	return broadCastEvent, ok
 }
 
-func unmarshalLap(buffer *bytes.Buffer) (lap Lap, ok bool) {
+// MarshalLap writes the lap as embedded in the RealTimeUpdate and RealTimeCarUpdate.
+// Unlike the other Marshal functions, no message-type is written.
+func MarshalLap(buffer *bytes.Buffer, lap Lap) (ok bool) {
+	ok = writeBuffer(buffer, lap.LapTimeMs)
+	ok = ok && writeBuffer(buffer, lap.CarId)
+	ok = ok && writeBuffer(buffer, lap.DriverId)
+
+	ok = ok && writeBuffer(buffer, uint8(len(lap.Splits)))
+	for i := 0; ok && i < len(lap.Splits); i++ {
+		ok = ok && writeBuffer(buffer, lap.Splits[i])
+	}
+	ok = ok && writeBuffer(buffer, lap.IsInvalid)
+	ok = ok && writeBuffer(buffer, lap.IsValidForBest)
+	ok = ok && writeBuffer(buffer, lap.IsOutLap)
+	ok = ok && writeBuffer(buffer, lap.IsInLap)
+	return ok
+}
+
+// UnmarshalLap is the counterpart of MarshalLap. Invalid splits are kept as InvalidSectorTime, such that
+// marshaling the lap again results in the same bytes.
+func UnmarshalLap(buffer *bytes.Buffer) (lap Lap, ok bool) {
 	ok = readBuffer(buffer, &lap.LapTimeMs)
 	ok = ok && readBuffer(buffer, &lap.CarId)
 	ok = ok && readBuffer(buffer, &lap.DriverId)
@@ -466,10 +795,6 @@ func unmarshalLap(buffer *bytes.Buffer) (lap Lap, ok bool) {
 	lap.Splits = make([]int32, splitCount)
 	for i := uint8(0); ok && i < splitCount; i++ {
 		ok = ok && readBuffer(buffer, &(lap.Splits[i]))
-
-		if lap.Splits[i] == InvalidSectorTime {
-			lap.Splits[i] = 0
-		}
 	}
 	ok = ok && readBuffer(buffer, &lap.IsInvalid)
 	ok = ok && readBuffer(buffer, &lap.IsValidForBest)
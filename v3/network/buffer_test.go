@@ -3,6 +3,7 @@ package network
 import (
 	"bytes"
 	"encoding/binary"
+	"reflect"
 	"testing"
 )
 
@@ -44,3 +45,227 @@ func isCalledFn(isCalled *bool) bool {
 	*isCalled = true
 	return true
 }
+
+func TestMarshalFocusReq(t *testing.T) {
+	var buffer bytes.Buffer
+	ok := MarshalFocusReq(&buffer, 7, 12, "Onboard", "Onboard1")
+	expected := []byte{ChangeFocus, 7, 0, 0, 0, 1, 12, 0, 1, 7, 0, 'O', 'n', 'b', 'o', 'a', 'r', 'd', 8, 0, 'O', 'n', 'b', 'o', 'a', 'r', 'd', '1'}
+	if !ok || !bytes.Equal(buffer.Bytes(), expected) {
+		t.Errorf("unexpected focus-req: %v", buffer.Bytes())
+	}
+
+	buffer.Reset()
+	ok = MarshalFocusReq(&buffer, 7, -1, "Onboard", "")
+	expected = []byte{ChangeFocus, 7, 0, 0, 0, 0, 0}
+	if !ok || !bytes.Equal(buffer.Bytes(), expected) {
+		t.Errorf("unexpected focus-req without car and camera: %v", buffer.Bytes())
+	}
+}
+
+func TestMarshalHUDPageReq(t *testing.T) {
+	var buffer bytes.Buffer
+	ok := MarshalHUDPageReq(&buffer, 3, HUDPageHelp)
+	expected := []byte{ChangeHUDPage, 3, 0, 0, 0, 4, 0, 'H', 'e', 'l', 'p'}
+	if !ok || !bytes.Equal(buffer.Bytes(), expected) {
+		t.Errorf("unexpected hudpage-req: %v", buffer.Bytes())
+	}
+}
+
+func TestIsKnownHUDPage(t *testing.T) {
+	if !IsKnownHUDPage(HUDPageBasicHUD) || IsKnownHUDPage("basic hud") {
+		t.Fail()
+	}
+}
+
+func TestMarshalInstantReplayReq(t *testing.T) {
+	var buffer bytes.Buffer
+	ok := MarshalInstantReplayReq(&buffer, 3, 60000, 10000, -1, "", "")
+	if !ok || buffer.Len() != 1+4+4+4+4+2+2 {
+		t.Fatalf("unexpected instantreplay-req: %v", buffer.Bytes())
+	}
+	var msgType byte
+	var connectionId, carId int32
+	var startSessionTimeMs, durationMs float32
+	readBuffer(&buffer, &msgType)
+	readBuffer(&buffer, &connectionId)
+	readBuffer(&buffer, &startSessionTimeMs)
+	readBuffer(&buffer, &durationMs)
+	readBuffer(&buffer, &carId)
+	if msgType != InstantReplayRequest || connectionId != 3 || startSessionTimeMs != 60000 || durationMs != 10000 || carId != -1 {
+		t.Errorf("unexpected content of instantreplay-req")
+	}
+}
+
+func testLap(carId uint16) Lap {
+	return Lap{LapTimeMs: 138512, CarId: carId, DriverId: 1, Splits: []int32{45123, 50321, 43068}, IsValidForBest: 1}
+}
+
+// readMsgType consumes the message-type that is written by the Marshal functions
+func readMsgType(t *testing.T, buffer *bytes.Buffer, expected byte) {
+	msgType, err := buffer.ReadByte()
+	if err != nil || msgType != expected {
+		t.Fatalf("expected msg-type %d but got %d (err:%v)", expected, msgType, err)
+	}
+}
+
+func TestLapRoundTrip(t *testing.T) {
+	lap := Lap{LapTimeMs: 141234, CarId: 3, DriverId: 1, Splits: []int32{45123, InvalidSectorTime, 43068}, IsInvalid: 1}
+	var buffer bytes.Buffer
+	if !MarshalLap(&buffer, lap) {
+		t.Fatal("marshal failed")
+	}
+	marshaled := append([]byte(nil), buffer.Bytes()...)
+	result, ok := UnmarshalLap(&buffer)
+	if !ok || !reflect.DeepEqual(result, lap) {
+		t.Fatalf("expected %+v, got %+v", lap, result)
+	}
+
+	MarshalLap(&buffer, result)
+	if !bytes.Equal(buffer.Bytes(), marshaled) {
+		t.Error("marshaling the unmarshaled lap results in different bytes")
+	}
+}
+
+func TestConnectionRespRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	if !MarshalConnectionResp(&buffer, 5, 1, 0, "") {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, RegistrationResultMsgType)
+	connectionId, connectionSuccess, isWritable, errMsg, ok := UnmarshalConnectionResp(&buffer)
+	if !ok || connectionId != 5 || connectionSuccess != 1 || isWritable != 0 || errMsg != "" {
+		t.Errorf("unexpected registration-result: %d %d %d '%s'", connectionId, connectionSuccess, isWritable, errMsg)
+	}
+}
+
+func TestRealTimeUpdateRoundTrip(t *testing.T) {
+	expected := RealTimeUpdate{
+		SessionIndex:    2,
+		SessionType:     SessionTypeRace,
+		Phase:           SessionPhaseSession,
+		SessionTime:     123456,
+		SessionEndTime:  3600000,
+		FocusedCarIndex: 3,
+		ActiveCameraSet: "Drivable",
+		ActiveCamera:    "Chase",
+		CurrentHUDPage:  HUDPageBasicHUD,
+		IsReplayPlaying: 1,
+		ReplayTime:      100000,
+		ReplayRemaining: 5000,
+		TimeOfDay:       50400,
+		AmbientTemp:     21,
+		TrackTemp:       29,
+		BestSessionLap:  testLap(3),
+	}
+	var buffer bytes.Buffer
+	if !MarshalRealTimeUpdate(&buffer, expected) {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, RealtimeUpdateMsgType)
+	actual, ok := UnmarshalRealTimeUpdate(&buffer)
+	if !ok || !reflect.DeepEqual(actual, expected) || buffer.Len() != 0 {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestCarUpdateRoundTrip(t *testing.T) {
+	expected := RealTimeCarUpdate{
+		Id:             3,
+		DriverId:       1,
+		DriverCount:    2,
+		Gear:           4,
+		CarLocation:    CarLocationTrack,
+		Kmh:            212,
+		Position:       2,
+		CupPosition:    1,
+		SplinePosition: 0.42,
+		Laps:           12,
+		Delta:          -250,
+		BestSessionLap: testLap(3),
+		LastLap:        testLap(3),
+		CurrentLap:     Lap{LapTimeMs: 30123, CarId: 3, DriverId: 1, Splits: []int32{}},
+	}
+	var buffer bytes.Buffer
+	if !MarshalCarUpdateResp(&buffer, expected) {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, RealtimeCarUpdateMsgType)
+	actual, ok := UnmarshalCarUpdateResp(&buffer)
+	if !ok || !reflect.DeepEqual(actual, expected) || buffer.Len() != 0 {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestEntryListRoundTrip(t *testing.T) {
+	expected := EntryList{0, 1, 2, 5}
+	var buffer bytes.Buffer
+	if !MarshalEntryListRep(&buffer, 5, expected) {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, EntryListMsgType)
+	connectionId, actual, ok := UnmarshalEntryListRep(&buffer)
+	if !ok || connectionId != 5 || !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestEntryListCarRoundTrip(t *testing.T) {
+	expected := EntryListCar{
+		Id:              2,
+		Model:           CarModelPorsche,
+		TeamName:        "Team",
+		RaceNumber:      911,
+		CupCategory:     1,
+		CurrentDriverId: 1,
+		Nationality:     NationalityGermany,
+		Drivers: []Driver{
+			{FirstName: "First", LastName: "Driver", ShortName: "FDR", Category: 3, Nationality: NationalityGermany},
+			{FirstName: "Second", LastName: "Driver", ShortName: "SDR", Category: 1, Nationality: NationalityBelgium},
+		},
+	}
+	var buffer bytes.Buffer
+	if !MarshalEntryListCarResp(&buffer, expected) {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, EntryListCarMsgType)
+	actual, ok := UnmarshalEntryListCarResp(&buffer)
+	if !ok || !reflect.DeepEqual(actual, expected) || buffer.Len() != 0 {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestTrackDataRoundTrip(t *testing.T) {
+	expected := TrackData{
+		Name:   TrackNameZolder,
+		Id:     TrackIdZolder,
+		Meters: 4011,
+		CameraSets: map[string][]string{
+			"Drivable": {"Chase", "FarChase", "Bonnet", "DashPro", "Cockpit", "Dash", "Helmet"},
+			"Onboard":  {"Onboard0", "Onboard1", "Onboard2", "Onboard3"},
+			"pitlane":  {},
+		},
+		HUDPages: []string{HUDPageBlank, HUDPageBasicHUD, HUDPageHelp, HUDPageTimeTable, HUDPageBroadcasting, HUDPageTrackMap},
+	}
+	var buffer bytes.Buffer
+	if !MarshalTrackDataResp(&buffer, 5, expected) {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, TrackDataMsgType)
+	connectionId, actual, ok := UnmarshalTrackDataResp(&buffer)
+	if !ok || connectionId != 5 || !reflect.DeepEqual(actual, expected) || buffer.Len() != 0 {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+}
+
+func TestBroadCastEventRoundTrip(t *testing.T) {
+	expected := BroadCastEvent{Type: BroadCastEventTypeLapCompleted, Msg: "2:18.512", TimeMs: 654321, CarId: 3}
+	var buffer bytes.Buffer
+	if !MarshalBroadCastEvent(&buffer, expected) {
+		t.Fatal("marshalling failed")
+	}
+	readMsgType(t, &buffer, BroadcastingEventMsgType)
+	actual, ok := UnmarshalBroadCastEvent(&buffer)
+	if !ok || actual != expected || buffer.Len() != 0 {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction of a datagram, as seen from the client
+type Direction byte
+
+const (
+	Inbound  Direction = 1 // send by ACC to the client
+	Outbound Direction = 2 // send by the client to ACC
+)
+
+// Recorder is called by the Client for every datagram that is send to or received from ACC.
+// The datagram is only valid during the call, thus a Recorder needs to copy it if it is retained.
+type Recorder interface {
+	Record(direction Direction, datagram []byte)
+}
+
+// A capture consists of a header followed by a record for every datagram. All integers are little-endian.
+//
+//	header: magic "ACCCAP" | version (byte) | wall-clock at start of capture (int64, ns since unix epoch)
+//	record: offset since start of capture (int64, ns, monotonic) | direction (byte) | length (uint32) | datagram
+const captureMagic = "ACCCAP"
+const captureVersion byte = 1
+
+// maxDatagramSize is the maximum payload of a UDP datagram, a longer record means the capture is corrupt
+const maxDatagramSize = 65507
+
+// CaptureRecord is a single datagram read back from a capture
+type CaptureRecord struct {
+	Offset    time.Duration // time since the start of the capture
+	Direction Direction
+	Datagram  []byte
+}
+
+// CaptureWriter is a Recorder that writes all datagrams to a capture
+//
+// It is safe to be used by a Client that is sending requests from another go-routine than the one listening.
+// Writing errors are not returned to the Client but are kept and can be retrieved with Err.
+type CaptureWriter struct {
+	mutex sync.Mutex
+	w     *bufio.Writer
+	start time.Time
+	err   error
+}
+
+// NewCaptureWriter writes the header of the capture to w.
+// Flush needs to be called once recording is done.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	captureWriter := &CaptureWriter{w: bufio.NewWriter(w), start: time.Now()}
+	captureWriter.w.WriteString(captureMagic)
+	captureWriter.w.WriteByte(captureVersion)
+	err := binary.Write(captureWriter.w, binary.LittleEndian, captureWriter.start.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	return captureWriter, nil
+}
+
+// Record writes the datagram to the capture, time-stamped with the time since the capture started
+func (captureWriter *CaptureWriter) Record(direction Direction, datagram []byte) {
+	captureWriter.mutex.Lock()
+	defer captureWriter.mutex.Unlock()
+
+	// taken under the lock such that the offsets of the records are increasing
+	offset := time.Since(captureWriter.start)
+	if captureWriter.err != nil {
+		return
+	}
+	err := binary.Write(captureWriter.w, binary.LittleEndian, int64(offset))
+	if err == nil {
+		err = captureWriter.w.WriteByte(byte(direction))
+	}
+	if err == nil {
+		err = binary.Write(captureWriter.w, binary.LittleEndian, uint32(len(datagram)))
+	}
+	if err == nil {
+		_, err = captureWriter.w.Write(datagram)
+	}
+	captureWriter.err = err
+}
+
+// Flush writes any buffered records to the underlying writer
+func (captureWriter *CaptureWriter) Flush() error {
+	captureWriter.mutex.Lock()
+	defer captureWriter.mutex.Unlock()
+
+	if captureWriter.err != nil {
+		return captureWriter.err
+	}
+	captureWriter.err = captureWriter.w.Flush()
+	return captureWriter.err
+}
+
+// Err returns the first error encountered while recording
+func (captureWriter *CaptureWriter) Err() error {
+	captureWriter.mutex.Lock()
+	defer captureWriter.mutex.Unlock()
+	return captureWriter.err
+}
+
+// CaptureReader reads back a capture written by the CaptureWriter
+type CaptureReader struct {
+	r     *bufio.Reader
+	start time.Time
+}
+
+// NewCaptureReader reads the header of the capture
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	captureReader := &CaptureReader{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(captureMagic)+1)
+	if _, err := io.ReadFull(captureReader.r, header); err != nil {
+		return nil, fmt.Errorf("reading capture header: %w", err)
+	}
+	if string(header[:len(captureMagic)]) != captureMagic {
+		return nil, errors.New("not an ACC broadcasting capture")
+	}
+	if header[len(captureMagic)] != captureVersion {
+		return nil, fmt.Errorf("unsupported capture version %d", header[len(captureMagic)])
+	}
+
+	var startNs int64
+	if err := binary.Read(captureReader.r, binary.LittleEndian, &startNs); err != nil {
+		return nil, fmt.Errorf("reading capture header: %w", err)
+	}
+	captureReader.start = time.Unix(0, startNs)
+	return captureReader, nil
+}
+
+// Start returns the wall-clock time at which the capture started
+func (captureReader *CaptureReader) Start() time.Time {
+	return captureReader.start
+}
+
+// Next returns the next record in the capture. At the end of the capture, io.EOF is returned.
+// A capture that is cut off in the middle of a record results in io.ErrUnexpectedEOF. A record longer than the
+// maximum size of a UDP datagram is considered corrupt and results in an error.
+func (captureReader *CaptureReader) Next() (record CaptureRecord, err error) {
+	var offset int64
+	err = binary.Read(captureReader.r, binary.LittleEndian, &offset)
+	if err != nil {
+		return record, err
+	}
+
+	var direction byte
+	var length uint32
+	err = binary.Read(captureReader.r, binary.LittleEndian, &direction)
+	if err == nil {
+		err = binary.Read(captureReader.r, binary.LittleEndian, &length)
+	}
+	if err == nil && length > maxDatagramSize {
+		return CaptureRecord{}, fmt.Errorf("corrupt capture: record of %d bytes exceeds the maximum datagram size", length)
+	}
+	if err == nil {
+		record.Datagram = make([]byte, length)
+		_, err = io.ReadFull(captureReader.r, record.Datagram)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return CaptureRecord{}, err
+	}
+
+	record.Offset = time.Duration(offset)
+	record.Direction = Direction(direction)
+	return record, nil
+}
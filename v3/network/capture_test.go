@@ -0,0 +1,155 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	var capture bytes.Buffer
+	captureWriter, err := NewCaptureWriter(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var datagram bytes.Buffer
+	MarshalEntryListReq(&datagram, 3)
+	captureWriter.Record(Outbound, datagram.Bytes())
+	datagram.Reset()
+	MarshalEntryListRep(&datagram, 3, EntryList{0, 1})
+	captureWriter.Record(Inbound, datagram.Bytes())
+	if err = captureWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	captureReader, err := NewCaptureReader(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := captureReader.Next()
+	if err != nil || first.Direction != Outbound || first.Datagram[0] != RequestEntryList {
+		t.Errorf("unexpected first record %+v (err:%v)", first, err)
+	}
+	second, err := captureReader.Next()
+	if err != nil || second.Direction != Inbound || !bytes.Equal(second.Datagram, datagram.Bytes()) || second.Offset < first.Offset {
+		t.Errorf("unexpected second record %+v (err:%v)", second, err)
+	}
+	if _, err = captureReader.Next(); err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+}
+
+func TestCaptureTruncated(t *testing.T) {
+	var capture bytes.Buffer
+	captureWriter, _ := NewCaptureWriter(&capture)
+	captureWriter.Record(Inbound, []byte{RealtimeUpdateMsgType, 1, 2, 3})
+	captureWriter.Flush()
+
+	captureReader, err := NewCaptureReader(bytes.NewReader(capture.Bytes()[:capture.Len()-2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = captureReader.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF but got %v", err)
+	}
+}
+
+func TestCaptureCorruptLength(t *testing.T) {
+	var capture bytes.Buffer
+	captureWriter, _ := NewCaptureWriter(&capture)
+	captureWriter.Flush()
+	// a record claiming a datagram of 4GB
+	capture.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, byte(Inbound), 0xff, 0xff, 0xff, 0xff})
+
+	captureReader, err := NewCaptureReader(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = captureReader.Next(); err == nil || err == io.ErrUnexpectedEOF {
+		t.Errorf("expected the length to be rejected but got %v", err)
+	}
+}
+
+func TestCaptureInvalidHeader(t *testing.T) {
+	if _, err := NewCaptureReader(bytes.NewReader([]byte("NOTACAPTURE....."))); err == nil {
+		t.Error("invalid header not detected")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var capture bytes.Buffer
+	captureWriter, _ := NewCaptureWriter(&capture)
+	var datagram bytes.Buffer
+	for i := 0; i < 3; i++ {
+		datagram.Reset()
+		MarshalRealTimeUpdate(&datagram, RealTimeUpdate{SessionTime: float32(i * 1000), BestSessionLap: testLap(0)})
+		captureWriter.Record(Inbound, datagram.Bytes())
+		datagram.Reset()
+		MarshalCarUpdateResp(&datagram, RealTimeCarUpdate{Id: 0, Laps: uint16(i)})
+		captureWriter.Record(Inbound, datagram.Bytes())
+		datagram.Reset()
+		MarshalEntryListReq(&datagram, 0) // outbound datagrams are not replayed
+		captureWriter.Record(Outbound, datagram.Bytes())
+	}
+	captureWriter.Flush()
+
+	var sessionTimes []float32
+	var laps []uint16
+	client := Client{
+		OnRealTimeUpdate:    func(update RealTimeUpdate) { sessionTimes = append(sessionTimes, update.SessionTime) },
+		OnRealTimeCarUpdate: func(update RealTimeCarUpdate) { laps = append(laps, update.Laps) },
+	}
+
+	captureReader, _ := NewCaptureReader(&capture)
+	replayer := Replayer{Client: &client}
+	if err := replayer.Replay(context.Background(), captureReader); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sessionTimes, []float32{0, 1000, 2000}) || !reflect.DeepEqual(laps, []uint16{0, 1, 2}) {
+		t.Errorf("unexpected replay: session-times %v, laps %v", sessionTimes, laps)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	var capture bytes.Buffer
+	captureWriter, _ := NewCaptureWriter(&capture)
+	var datagram bytes.Buffer
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		datagram.Reset()
+		MarshalRealTimeUpdate(&datagram, RealTimeUpdate{SessionTime: float32(i * 100), BestSessionLap: testLap(0)})
+		captureWriter.Record(Inbound, datagram.Bytes())
+	}
+	captureWriter.Flush()
+
+	// the recorded duration between the first and the last datagram
+	var span time.Duration
+	captureReader, _ := NewCaptureReader(bytes.NewReader(capture.Bytes()))
+	first, _ := captureReader.Next()
+	for record, err := captureReader.Next(); err == nil; record, err = captureReader.Next() {
+		span = record.Offset - first.Offset
+	}
+
+	updates := 0
+	client := Client{OnRealTimeUpdate: func(RealTimeUpdate) { updates++ }}
+	captureReader, _ = NewCaptureReader(&capture)
+	replayer := Replayer{Client: &client, Speed: 4}
+	start := time.Now()
+	if err := replayer.Replay(context.Background(), captureReader); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	if updates != 3 {
+		t.Errorf("expected 3 updates but got %d", updates)
+	}
+	if elapsed < span/4 || elapsed >= span/2 {
+		t.Errorf("replaying %v at speed 4 took %v", span, elapsed)
+	}
+}
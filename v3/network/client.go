@@ -2,15 +2,34 @@ package network
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"net"
+	"sync"
 	"time"
 )
 
 const BroadcastingProtocolVersion byte = 4
 const ReadBufferSize = 32 * 1024
 
+// noConnectionId is used as connection-id while ACC did not acknowledge the registration
+const noConnectionId int32 = -1
+
+// Config contains the parameters to connect to the ACC broadcasting interface.
+// These correspond to the settings in the broadcasting.json of ACC.
+type Config struct {
+	Address                  string // e.g. "127.0.0.1:9000"
+	DisplayName              string // name shown in ACC for this connection
+	ConnectionPassword       string
+	CommandPassword          string // needed to send commands like RequestFocus
+	RealtimeUpdateIntervalMs int32  // interval at which OnRealTimeUpdate and OnRealTimeCarUpdate are called
+
+	// TimeoutMs is the time ACC can stay silent before the connection is considered broken
+	TimeoutMs int32
+}
+
 // After the connection is established, the OnRealTimeUpdate and OnRealTimeCarUpdate (for each car)
 // will be called at the 'msRealTimeUpdateInterval`, the sample rate that is specified when connecting.
 // Additionally OnBroadCastEvent will be called infrequently.
@@ -20,23 +39,30 @@ const ReadBufferSize = 32 * 1024
 // and OnEntryListCar (for each car) will be called. As a response to the request for track-data, OnTrackData
 // will be called.
 //
-// For coherency, OnRealTimeCarUpdate will only be called after OnEntryList and the corresponding OnEntryListCar
-// have been called.
+// For coherency, GateOnEntryList can be set such that OnRealTimeCarUpdate will only be called after OnEntryList and
+// the corresponding OnEntryListCar have been called.
 //
-// Additionally whenever a car joins (and thus an update on that car without it being in the most recent entry-list),
-// the OnRealCarUpdate is propagated. Instead a new request for the entry-list will be send and any onRealTimeCarUpdate's
-// will only be received once the new entry-list is received and all the OnEntryListCar
+// Additionally whenever a car joins (and thus an update on that car arrives without it being in the most recent
+// entry-list), the OnRealTimeCarUpdate is then not propagated. Instead a new request for the entry-list will be send
+// and the OnRealTimeCarUpdate's of that car will only be called once the new entry-list is received and the
+// OnEntryListCar of that car was called.
+//
+// Instead of (or in addition to) setting the callbacks, all messages can be received as an Event from the channel
+// returned by Events. To distribute the messages to several independent consumers, see Hub.
+//
+// The callbacks are called from the go-routine reading the connection, see Dispatcher to decouple slow callbacks.
 type Client struct {
 	Logger zerolog.Logger
 
-	OnConnected    func(connectionId int32)
+	OnConnected func(connectionId int32)
+	// OnDisconnected is only called if OnConnected was called before, not if e.g. the registration is rejected
 	OnDisconnected func()
 
 	// OnRealTimeUpdate is called at every time sample
 	OnRealTimeUpdate func(RealTimeUpdate)
 
 	// OnRealTimeCarUpdate is called at every time sample.
-	// It might contain an update for a car that was not in the last received entryList
+	// It might contain an update for a car that was not in the last received entryList, unless GateOnEntryList is set
 	OnRealTimeCarUpdate func(RealTimeCarUpdate)
 
 	//
@@ -54,234 +80,486 @@ type Client struct {
 	// The TrackData is requested once the connection is established
 	OnTrackData func(TrackData)
 
+	// GateOnEntryList makes sure OnRealTimeCarUpdate is only called for cars of which OnEntryListCar was called.
+	// An update of an unknown car triggers a request for a new entry-list (at most once every
+	// EntryListRequestInterval). The most recent update of each unknown car is kept and passed to
+	// OnRealTimeCarUpdate right after the OnEntryListCar of that car, unless DropUnknownCarUpdates is set.
+	// See DroppedCarUpdates for the number of updates that were not propagated.
+	GateOnEntryList          bool
+	EntryListRequestInterval time.Duration // defaults to DefaultEntryListRequestInterval
+	DropUnknownCarUpdates    bool
+
+	// OnCarJoined is called, if GateOnEntryList is set, right after OnEntryListCar for every car that was not in
+	// the previous entry-list. It is not called for the cars of the first entry-list received after connecting.
+	OnCarJoined func(EntryListCar)
+
+	// EventBufferSize and EventOverflow configure the channel returned by Events
+	EventBufferSize int            // defaults to DefaultEventBufferSize
+	EventOverflow   OverflowPolicy // defaults to OverflowBlock
+
+	// Recorder, if set, is called with every datagram that is send to or received from ACC,
+	// e.g. to write a capture of the session using a CaptureWriter
+	Recorder Recorder
+
+	// mutex protects the fields below as the Request methods can be called from any go-routine
+	mutex sync.Mutex
+
 	// conn is the UDP connection to ACC
-	// Set and unset in ConnectListenAndCallback
+	// Set and unset in Run
 	conn *net.UDPConn
 
-	timeOutDuration time.Duration
-
 	// connectionId is received when being registered on the UDP interface.
-	// At every subsequent request, the connectionId needs to be send along
+	// At every subsequent request, the connectionId needs to be send along.
+	// It is noConnectionId as long as ACC did not acknowledge the registration.
 	connectionId int32
 
-	// stopListening can be set to true to stop the 'ConnectListenAndCallback'
-	stopListening bool
+	// readOnly is set if ACC did not accept the command-password at registration
+	readOnly bool
+
+	// cancel stops the ongoing Run, used by RequestDisconnect
+	cancel context.CancelFunc
+
+	droppedCarUpdates uint64
+
+	// events is created by Events, eventsDone is closed when the ongoing Run stops
+	events        chan Event
+	eventsDone    <-chan struct{}
+	droppedEvents uint64
+
+	// gate is only used within dispatch, thus is not protected by the mutex
+	gate entryListGate
 }
 
-// ConnectListenAndCallback will connect to the ACC UDP broadcasting interface and call the corresponding callback for
+// Run will connect to the ACC UDP broadcasting interface and call the corresponding callback for
 // each data element that is received.
 //
-// When trying to connect or while being connected and nothing was received within the 'timeoutMs' interval,
-// the connection will be considered broken and this function will return.
+// When trying to connect or while being connected and nothing was received within the 'TimeoutMs' interval,
+// the connection will be considered broken and Run returns with an error. If ACC refuses the registration
+// (e.g. due to a wrong ConnectionPassword), neither OnConnected nor OnDisconnected is called and Run returns
+// ErrRegistrationRejected.
+// All errors returned, apart from the error of the context, are an *Error carrying one of the Error<name> codes
+// such that errors.Is can be used to check for e.g. ErrReadTimeout.
 //
-// To stop listening to the UDP interface, `RequestDisconnect()` can be called. This function will attempt to
-// disconnect from the UDP interface (as to be able to reconnect again) before returning. Note that it might
-// take 'timeoutMs' before the disconnect will be send to ACC after the execution of RequestDisconnect.
-func (client *Client) ConnectListenAndCallback(address string, displayName string, connectionPassword string, msRealtimeUpdateInterval int32, commandPassword string, timeoutMs int32) (success bool, errMsg string) {
-	client.timeOutDuration = time.Duration(timeoutMs) * time.Millisecond
+// To stop listening to the UDP interface, the context can be cancelled. Run will then immediately stop listening,
+// disconnect from the UDP interface (as to be able to reconnect again) and return the error of the context.
+func (client *Client) Run(ctx context.Context, cfg Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client.mutex.Lock()
+	client.cancel = cancel
+	client.eventsDone = ctx.Done()
+	client.mutex.Unlock()
+
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	conn, err := client.connect(cfg, timeout)
+	if err != nil {
+		return err
+	}
+
+	// unblock the read in listen as soon as the context is cancelled
+	listening := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-listening:
+		}
+	}()
 
-	success, errMsg = client.connect(address, displayName, connectionPassword, msRealtimeUpdateInterval, commandPassword)
+	err = client.listen(ctx, conn, timeout)
+	close(listening)
+	// closes eventsDone such that emitting Disconnected can not block when nobody reads the events anymore
+	cancel()
+	client.disconnect(conn, timeout)
 
-	if success {
-		success, errMsg = client.listen()
-	}
-	client.disconnect()
+	client.mutex.Lock()
+	client.cancel = nil
+	client.mutex.Unlock()
 
 	client.Logger.Info().Msgf("ACC client stopped listening and disconnected")
-	return success, errMsg
+	return err
 }
 
-func (client *Client) RequestTrackData() (ok bool) {
-	if client.stopListening {
-		return true
+// ConnectListenAndCallback runs the client (see Run) until RequestDisconnect is called or the connection is broken.
+//
+// If the client stopped due to RequestDisconnect, nil is returned. Otherwise the returned error is an *Error
+// (see IsRetryable).
+func (client *Client) ConnectListenAndCallback(address string, displayName string, connectionPassword string, msRealtimeUpdateInterval int32, commandPassword string, timeoutMs int32) error {
+	err := client.Run(context.Background(), Config{
+		Address:                  address,
+		DisplayName:              displayName,
+		ConnectionPassword:       connectionPassword,
+		CommandPassword:          commandPassword,
+		RealtimeUpdateIntervalMs: msRealtimeUpdateInterval,
+		TimeoutMs:                timeoutMs,
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
 	}
+	return err
+}
 
-	client.Logger.Debug().Msgf("Requesting track data (connectionId:%d)", client.connectionId)
+func (client *Client) RequestTrackData() error {
+	connectionId := client.currentConnectionId()
+	client.Logger.Debug().Msgf("Requesting track data (connectionId:%d)", connectionId)
 	var writeBuffer bytes.Buffer
-	MarshalTrackDataReq(&writeBuffer, client.connectionId)
-	n, err := client.conn.Write(writeBuffer.Bytes())
-	if n != writeBuffer.Len() {
-		client.Logger.Error().Msgf("Error while writing trackdata-req, wrote only %d bytes while it should have been %d", n, writeBuffer.Len())
-		return false
-	}
-	if err != nil {
-		client.Logger.Error().Msgf("Error while writing trackdata-req, %v", err)
-		return false
-	}
-	return true
+	MarshalTrackDataReq(&writeBuffer, connectionId)
+	return client.send(&writeBuffer, "trackdata-req")
 }
 
-func (client *Client) RequestEntryList() (ok bool) {
-	if client.stopListening {
-		return true
+func (client *Client) RequestEntryList() error {
+	connectionId := client.currentConnectionId()
+	client.Logger.Debug().Msgf("Requesting new entrylist (connectionId:%d)", connectionId)
+	var writeBuffer bytes.Buffer
+	MarshalEntryListReq(&writeBuffer, connectionId)
+	err := client.send(&writeBuffer, "entrylist-req")
+	client.Logger.Debug().Msgf("Send new EntryList request for connection %d", connectionId)
+	return err
+}
+
+// RequestFocus requests ACC to focus on the car with the given id (see EntryListCar.Id).
+//
+// If both cameraSet and camera are non-empty, ACC will also switch to that camera. Otherwise the active
+// camera is kept. The names of the camera-sets and cameras can be found in the RealTimeUpdate.ActiveCameraSet
+// and RealTimeUpdate.ActiveCamera.
+func (client *Client) RequestFocus(carId uint16, cameraSet string, camera string) error {
+	return client.requestFocus(int32(carId), cameraSet, camera)
+}
+
+// RequestCamera requests ACC to switch to another camera without changing the focused car
+func (client *Client) RequestCamera(cameraSet string, camera string) error {
+	return client.requestFocus(-1, cameraSet, camera)
+}
+
+func (client *Client) requestFocus(carId int32, cameraSet string, camera string) error {
+	if err := client.checkWritable("focus-req"); err != nil {
+		return err
 	}
 
-	client.Logger.Debug().Msgf("Requesting new entrylist (connectionId:%d)", client.connectionId)
+	connectionId := client.currentConnectionId()
+	client.Logger.Debug().Msgf("Requesting focus on car %d, camera '%s'/'%s' (connectionId:%d)", carId, cameraSet, camera, connectionId)
 	var writeBuffer bytes.Buffer
-	MarshalEntryListReq(&writeBuffer, client.connectionId)
-	n, err := client.conn.Write(writeBuffer.Bytes())
-	client.Logger.Debug().Msgf("Send new EntryList request for connection %d", client.connectionId)
-	if n != writeBuffer.Len() {
-		client.Logger.Error().Msgf("Error while writing entrylist-req, wrote only %d bytes while it should have been %d", n, writeBuffer.Len())
-		return false
+	MarshalFocusReq(&writeBuffer, connectionId, carId, cameraSet, camera)
+	return client.send(&writeBuffer, "focus-req")
+}
+
+// RequestHUDPage requests ACC to show another HUD page.
+//
+// The page needs to be one of the constants HUDPage<name>, otherwise the request is not send. The page
+// that is shown afterwards is reported in RealTimeUpdate.CurrentHUDPage.
+func (client *Client) RequestHUDPage(page string) error {
+	if !IsKnownHUDPage(page) {
+		client.Logger.Error().Int(Code, ErrorInvalidRequest).Msgf("Not requesting unknown HUD page '%s'", page)
+		return newError(ErrorInvalidRequest, fmt.Sprintf("unknown HUD page '%s'", page), nil)
 	}
-	if err != nil {
-		client.Logger.Error().Msgf("Error while writing entrylist-req, %v", err)
-		return false
+	if err := client.checkWritable("hudpage-req"); err != nil {
+		return err
+	}
+
+	connectionId := client.currentConnectionId()
+	client.Logger.Debug().Msgf("Requesting HUD page '%s' (connectionId:%d)", page, connectionId)
+	var writeBuffer bytes.Buffer
+	MarshalHUDPageReq(&writeBuffer, connectionId, page)
+	return client.send(&writeBuffer, "hudpage-req")
+}
+
+// RequestInstantReplay requests ACC to replay the part of the session starting at startSessionTimeMs
+// (see RealTimeUpdate.SessionTime) and lasting durationMs.
+//
+// The replay is focused on the car with the given carId, or on the currently focused car if carId is negative.
+// Similarly the active camera is kept if cameraSet or camera is empty. While the replay is playing,
+// RealTimeUpdate.IsReplayPlaying is set and RealTimeUpdate.ReplayTime and RealTimeUpdate.ReplayRemaining
+// report the progress of the replay.
+func (client *Client) RequestInstantReplay(startSessionTimeMs float32, durationMs float32, carId int32, cameraSet string, camera string) error {
+	if err := client.checkWritable("instantreplay-req"); err != nil {
+		return err
 	}
-	return true
+
+	connectionId := client.currentConnectionId()
+	client.Logger.Debug().Msgf("Requesting instant replay from %.0fms for %.0fms on car %d (connectionId:%d)", startSessionTimeMs, durationMs, carId, connectionId)
+	var writeBuffer bytes.Buffer
+	MarshalInstantReplayReq(&writeBuffer, connectionId, startSessionTimeMs, durationMs, carId, cameraSet, camera)
+	return client.send(&writeBuffer, "instantreplay-req")
 }
 
+// RequestDisconnect stops the ongoing Run or ConnectListenAndCallback, see Run for cancelling through a context
 func (client *Client) RequestDisconnect() {
-	client.stopListening = true
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.cancel != nil {
+		client.cancel()
+	}
 }
 
-func (client *Client) connect(address string, displayName string, connectionPassword string, msRealtimeUpdateInterval int32, commandPassword string) (success bool, errMsg string) {
-	client.stopListening = false
+// IsReadOnly returns true if ACC did not accept the command-password at registration.
+// Commands like RequestFocus, RequestHUDPage and RequestInstantReplay will then return ErrReadOnly.
+func (client *Client) IsReadOnly() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.readOnly
+}
 
-	client.Logger.Info().Msgf("Connecting to %s", address)
+// checkWritable returns ErrReadOnly if commands can not be send to ACC.
+// The reqName is only used for logging and in the returned error.
+func (client *Client) checkWritable(reqName string) error {
+	if client.IsReadOnly() {
+		client.Logger.Warn().Int(Code, ErrorReadOnly).Msgf("Not writing %s, connection is read-only", reqName)
+		return newError(ErrorReadOnly, fmt.Sprintf("not writing %s", reqName), nil)
+	}
+	return nil
+}
+
+func (client *Client) currentConnectionId() int32 {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.connectionId
+}
 
-	raddr, err := net.ResolveUDPAddr("udp", address)
+func (client *Client) connect(cfg Config, timeout time.Duration) (conn *net.UDPConn, err error) {
+	client.Logger.Info().Msgf("Connecting to %s", cfg.Address)
+
+	raddr, err := net.ResolveUDPAddr("udp", cfg.Address)
 	if err != nil {
 		client.Logger.Error().Int(Code, ErrorAddressNotResolved).Msgf("error resolving address:%v", err)
-		return false, errMsg
+		return nil, newError(ErrorAddressNotResolved, fmt.Sprintf("resolving address %s", cfg.Address), err)
 	}
 
-	client.conn, err = net.DialUDP("udp", nil, raddr)
+	conn, err = net.DialUDP("udp", nil, raddr)
 	if err != nil {
-		client.Logger.Error().Int(Code, ErrorSetupUDPConnection).Msgf("error resolving address:%v", err)
-		return false, errMsg
+		client.Logger.Error().Int(Code, ErrorSetupUDPConnection).Msgf("error setting up UDP connection:%v", err)
+		return nil, newError(ErrorSetupUDPConnection, fmt.Sprintf("setting up UDP connection to %s", cfg.Address), err)
 	}
+	client.mutex.Lock()
+	client.conn = conn
+	client.connectionId = noConnectionId
+	client.readOnly = false
+	client.mutex.Unlock()
+	client.gate = entryListGate{}
 
 	var writeBuffer bytes.Buffer
-	MarshalRegistrationReq(&writeBuffer, displayName, connectionPassword, msRealtimeUpdateInterval, commandPassword)
-	client.conn.SetDeadline(time.Now().Add(client.timeOutDuration))
-	n, err := client.conn.Write(writeBuffer.Bytes())
-	if n < writeBuffer.Len() {
-		errMsg = fmt.Sprintf("registration request partially written only")
-		client.Logger.Error().Msg(errMsg)
-		return false, errMsg
-	}
+	MarshalRegistrationReq(&writeBuffer, cfg.DisplayName, cfg.ConnectionPassword, cfg.RealtimeUpdateIntervalMs, cfg.CommandPassword)
+	conn.SetDeadline(time.Now().Add(timeout))
+	err = client.send(&writeBuffer, "registration-req")
 	if err != nil {
-		errMsg = fmt.Sprintf("error while writing registration request to ACC: %v", err)
-		client.Logger.Error().Msg(errMsg)
-		return false, errMsg
+		client.mutex.Lock()
+		client.conn = nil
+		client.mutex.Unlock()
+		conn.Close()
+		return nil, err
 	}
 
 	client.Logger.Info().Int(Code, InfoRegistrationReqSendToAcc).Msgf("Registration request send to ACC")
-	return true, ""
+	return conn, nil
 }
 
-func (client *Client) listen() (success bool, errMsg string) {
-	success = true
+func (client *Client) listen(ctx context.Context, conn *net.UDPConn, timeout time.Duration) error {
 	var readArray [ReadBufferSize]byte
 
-	for !client.stopListening {
+	for {
 		// read socket
-		client.conn.SetDeadline(time.Now().Add(client.timeOutDuration))
-		n, err := client.conn.Read(readArray[:])
+		conn.SetDeadline(time.Now().Add(timeout))
+		// only check the context after the deadline is set, otherwise the deadline set when cancelling might be overridden
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n, err := conn.Read(readArray[:])
 		if err != nil {
-			success = false
-			client.stopListening = true
-			client.Logger.Error().Int(Code, ErrorReadTimeout).Msgf("ACC did not respond for %dms.: '%v'", client.timeOutDuration/time.Millisecond, err)
-			break
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			client.Logger.Error().Int(Code, ErrorReadTimeout).Msgf("ACC did not respond for %dms.: '%v'", timeout/time.Millisecond, err)
+			return newError(ErrorReadTimeout, fmt.Sprintf("ACC did not respond for %dms", timeout/time.Millisecond), err)
 		}
 		if n == ReadBufferSize {
 			client.Logger.Panic().Msg("Buffer not big enough !!!")
 		}
 
 		// extract msgType from first byte
+		client.record(Inbound, readArray[:n])
 		readBuffer := bytes.NewBuffer(readArray[:n])
 		msgType, err := readBuffer.ReadByte()
 		if err != nil {
-			success = false
-			client.stopListening = true
 			client.Logger.Error().Msgf("ACC message can not be interpreted: %v", err)
-			break
+			return newError(ErrorInvalidMessage, "ACC message can not be interpreted", err)
 		}
 
-		// handle msg
-		switch msgType {
-		case RegistrationResultMsgType:
-			client.Logger.Info().Msg("Recvd Registration")
-			connectionId, connectionSuccess, isReadOnly, errMsg, _ := UnmarshalConnectionResp(readBuffer)
-			client.connectionId = connectionId
-			client.Logger.Info().Int(Code, InfoRegistrationAckByAcc).Msgf("Connection: id:%d, success:%d, read-only:%d, err:'%s'", connectionId, connectionSuccess, isReadOnly, errMsg)
-			if client.OnConnected != nil {
-				client.OnConnected(client.connectionId)
-			}
+		err = client.dispatch(msgType, readBuffer)
+		if err != nil {
+			return err
+		}
+	}
+}
 
-		case RealtimeUpdateMsgType:
+// dispatch unmarshals the message of the given type and calls the corresponding callback.
+// It is used both when listening to ACC and when replaying a capture.
+//
+// An error is only returned if the message implies that the connection can not continue.
+func (client *Client) dispatch(msgType byte, readBuffer *bytes.Buffer) error {
+	hasEvents := client.hasEvents()
+
+	switch msgType {
+	case RegistrationResultMsgType:
+		client.Logger.Info().Msg("Recvd Registration")
+		connectionId, connectionSuccess, isWritable, errMsg, ok := UnmarshalConnectionResp(readBuffer)
+		if !ok {
+			return newError(ErrorInvalidMessage, "registration result can not be interpreted", nil)
+		}
+		if connectionSuccess == 0 {
+			// the connectionId remains unset (see connect), thus no requests or unregister can be send with
+			// the id of a previous connection
+			client.Logger.Error().Int(Code, ErrorRegistrationRejected).Msgf("Registration rejected by ACC: '%s'", errMsg)
+			return newError(ErrorRegistrationRejected, fmt.Sprintf("registration rejected by ACC: '%s'", errMsg), nil)
+		}
+		client.mutex.Lock()
+		client.connectionId = connectionId
+		client.readOnly = isWritable == 0
+		client.mutex.Unlock()
+		client.Logger.Info().Int(Code, InfoRegistrationAckByAcc).Msgf("Connection: id:%d, read-only:%t", connectionId, isWritable == 0)
+		if client.OnConnected != nil {
+			client.OnConnected(connectionId)
+		}
+		client.emit(Connected{ConnectionId: connectionId, ReadOnly: isWritable == 0})
+
+	case RealtimeUpdateMsgType:
+		if client.OnRealTimeUpdate != nil || hasEvents {
+			realTimeUpdate, _ := UnmarshalRealTimeUpdate(readBuffer)
 			if client.OnRealTimeUpdate != nil {
-				realTimeUpdate, _ := unmarshalRealTimeUpdate(readBuffer)
 				client.OnRealTimeUpdate(realTimeUpdate)
 			}
+			client.emit(realTimeUpdate)
+		}
 
-		case RealtimeCarUpdateMsgType:
-			if client.OnRealTimeCarUpdate != nil {
-				realTimeCarUpdate, _ := UnmarshalCarUpdateResp(readBuffer)
-				client.OnRealTimeCarUpdate(realTimeCarUpdate)
-			}
+	case RealtimeCarUpdateMsgType:
+		if client.GateOnEntryList {
+			realTimeCarUpdate, _ := UnmarshalCarUpdateResp(readBuffer)
+			client.gateCarUpdate(realTimeCarUpdate)
+		} else if client.OnRealTimeCarUpdate != nil || hasEvents {
+			realTimeCarUpdate, _ := UnmarshalCarUpdateResp(readBuffer)
+			client.realTimeCarUpdate(realTimeCarUpdate)
+		}
 
-		case EntryListMsgType:
+	case EntryListMsgType:
+		if client.OnEntryList != nil || client.GateOnEntryList || hasEvents {
+			connectionId, entryList, ok := UnmarshalEntryListRep(readBuffer)
+			client.Logger.Debug().Msgf("EntryList (connection:%d;ok=%t): %v", connectionId, ok, entryList)
+			if client.GateOnEntryList {
+				client.gateEntryList(entryList)
+			}
 			if client.OnEntryList != nil {
-				connectionId, entryList, ok := UnmarshalEntryListRep(readBuffer)
-				client.Logger.Debug().Msgf("EntryList (connection:%d;ok=%t): %v", connectionId, ok, entryList)
 				client.OnEntryList(entryList)
 			}
+			client.emit(entryList)
+		}
 
-		case EntryListCarMsgType:
+	case EntryListCarMsgType:
+		if client.OnEntryListCar != nil || client.GateOnEntryList || hasEvents {
+			entryListCar, _ := UnmarshalEntryListCarResp(readBuffer)
+			client.Logger.Debug().Msgf("EntryListCar: %+v", entryListCar)
 			if client.OnEntryListCar != nil {
-				entryListCar, _ := UnmarshalEntryListCarResp(readBuffer)
-				client.Logger.Debug().Msgf("EntryListCar: %+v", entryListCar)
 				client.OnEntryListCar(entryListCar)
 			}
+			client.emit(entryListCar)
+			if client.GateOnEntryList {
+				client.gateEntryListCar(entryListCar)
+			}
+		}
 
-		case TrackDataMsgType:
+	case TrackDataMsgType:
+		if client.OnTrackData != nil || hasEvents {
+			connectionId, trackData, ok := UnmarshalTrackDataResp(readBuffer)
+			client.Logger.Debug().Msgf("TrackData (connection:%d;ok=%t):%+v", connectionId, ok, trackData)
 			if client.OnTrackData != nil {
-				connectionId, trackData, ok := UnmarshalTrackDataResp(readBuffer)
-				client.Logger.Debug().Msgf("TrackData (connection:%d;ok=%t):%+v", connectionId, ok, trackData)
 				client.OnTrackData(trackData)
 			}
+			client.emit(trackData)
+		}
 
-		case BroadcastingEventMsgType:
+	case BroadcastingEventMsgType:
+		if client.OnBroadCastEvent != nil || hasEvents {
+			broadCastEvent, _ := UnmarshalBroadCastEvent(readBuffer)
 			if client.OnBroadCastEvent != nil {
-				broadCastEvent, _ := unmarshalBroadCastEvent(readBuffer)
 				client.OnBroadCastEvent(broadCastEvent)
 			}
-
-		default:
-			client.Logger.Warn().Msg("unrecognised msg-type")
+			client.emit(broadCastEvent)
 		}
+
+	default:
+		client.Logger.Warn().Msg("unrecognised msg-type")
 	}
+	return nil
+}
 
-	return success, errMsg
+// realTimeCarUpdate propagates the update to OnRealTimeCarUpdate and Events
+func (client *Client) realTimeCarUpdate(update RealTimeCarUpdate) {
+	if client.OnRealTimeCarUpdate != nil {
+		client.OnRealTimeCarUpdate(update)
+	}
+	client.emit(update)
 }
 
-func (client *Client) disconnect() {
-	var writeBuffer bytes.Buffer
-	ok := MarshalDisconnectReq(&writeBuffer, client.connectionId)
-	if !ok {
-		client.Logger.Error().Msgf("Error when marhalling disconnecting %d", client.connectionId)
+// send writes the marshalled request in writeBuffer to ACC.
+// The reqName is only used for logging and in the returned error.
+func (client *Client) send(writeBuffer *bytes.Buffer, reqName string) error {
+	client.mutex.Lock()
+	conn := client.conn
+	client.mutex.Unlock()
+	if conn == nil {
+		client.Logger.Warn().Int(Code, ErrorNotConnected).Msgf("Not writing %s, not connected to ACC", reqName)
+		return newError(ErrorNotConnected, fmt.Sprintf("not writing %s", reqName), nil)
+	}
+
+	client.record(Outbound, writeBuffer.Bytes())
+	n, err := conn.Write(writeBuffer.Bytes())
+	if err != nil {
+		client.Logger.Error().Int(Code, ErrorWriteFailed).Msgf("Error while writing %s, %v", reqName, err)
+		return newError(ErrorWriteFailed, fmt.Sprintf("writing %s", reqName), err)
 	}
-	n, err := client.conn.Write(writeBuffer.Bytes())
 	if n != writeBuffer.Len() {
-		client.Logger.Error().Msgf("Error while writing disconnect, wrote only %d bytes while it should have been %d", n, writeBuffer.Len())
-		return
+		client.Logger.Error().Int(Code, ErrorWriteFailed).Msgf("Error while writing %s, wrote only %d bytes while it should have been %d", reqName, n, writeBuffer.Len())
+		return newError(ErrorWriteFailed, fmt.Sprintf("writing %s, wrote only %d of %d bytes", reqName, n, writeBuffer.Len()), nil)
 	}
-	if err != nil {
-		client.Logger.Error().Msgf("Error while writing disconnect, %v", err)
-		return
+	return nil
+}
+
+func (client *Client) record(direction Direction, datagram []byte) {
+	if client.Recorder != nil {
+		client.Recorder.Record(direction, datagram)
+	}
+}
+
+func (client *Client) disconnect(conn *net.UDPConn, timeout time.Duration) {
+	// without an acknowledged registration there is nothing to unregister, and OnConnected was not called
+	connectionId := client.currentConnectionId()
+	connected := connectionId != noConnectionId
+	if connected {
+		var writeBuffer bytes.Buffer
+		ok := MarshalDisconnectReq(&writeBuffer, connectionId)
+		if !ok {
+			client.Logger.Error().Msgf("Error when marhalling disconnecting %d", connectionId)
+		}
+
+		// The deadline might already be exceeded if listening stopped due to a read-timeout.
+		// Even if the disconnect can not be send, the connection still needs to be closed.
+		conn.SetDeadline(time.Now().Add(timeout))
+		if client.send(&writeBuffer, "disconnect") == nil {
+			client.Logger.Info().Msgf("Disconnected %d was send", connectionId)
+		}
 	}
-	client.Logger.Info().Msgf("Disconnected %d was send", client.connectionId)
 
-	err = client.conn.Close()
+	client.mutex.Lock()
+	client.conn = nil
+	client.connectionId = noConnectionId
+	client.mutex.Unlock()
+	err := conn.Close()
 	if err != nil {
 		client.Logger.Warn().Msgf("Error while disconnecting: %v", err)
 	}
-	client.conn = nil
 
+	if !connected {
+		return
+	}
 	if client.OnDisconnected != nil {
 		client.OnDisconnected()
 	}
+	client.emit(Disconnected{})
 }
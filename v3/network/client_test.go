@@ -0,0 +1,568 @@
+package network_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network/acctest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTimeout = 2 * time.Second
+
+// startServer starts a fake ACC, the configure functions can modify the server before it is started
+func startServer(t *testing.T, configure ...func(*acctest.Server)) *acctest.Server {
+	server := &acctest.Server{
+		ConnectionPassword: "asd",
+		EntryList: []network.EntryListCar{
+			{Id: 0, TeamName: "Team A", RaceNumber: 7, Drivers: []network.Driver{{FirstName: "A", LastName: "Driver", ShortName: "ADR"}}},
+			{Id: 1, TeamName: "Team B", RaceNumber: 12, Drivers: []network.Driver{{FirstName: "B", LastName: "Driver", ShortName: "BDR"}}},
+		},
+		TrackData: network.TrackData{
+			Name:       network.TrackNameSpa,
+			Id:         network.TrackIdSpa,
+			Meters:     7004,
+			CameraSets: map[string][]string{"Onboard": {"Onboard0", "Onboard1"}},
+			HUDPages:   []string{network.HUDPageBasicHUD, network.HUDPageBroadcasting},
+		},
+	}
+	for _, f := range configure {
+		f(server)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	return server
+}
+
+// connect runs ConnectListenAndCallback in the background and waits until it is connected
+func connect(t *testing.T, client *network.Client, server *acctest.Server, connected chan int32) (connectionId int32, done chan error) {
+	done = make(chan error, 1)
+	go func() {
+		done <- client.ConnectListenAndCallback(server.Addr(), "test", "asd", 20, "", 500)
+	}()
+
+	select {
+	case connectionId = <-connected:
+	case <-time.After(testTimeout):
+		t.Fatal("OnConnected not called")
+	}
+	return connectionId, done
+}
+
+func TestConnectRequestAndDisconnect(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	connected := make(chan int32, 1)
+	entryListCars := make(chan network.EntryListCar, 10)
+	trackData := make(chan network.TrackData, 1)
+	realTimeUpdates := make(chan network.RealTimeUpdate, 100)
+
+	var client network.Client
+	client.OnConnected = func(connectionId int32) {
+		client.RequestEntryList()
+		client.RequestTrackData()
+		connected <- connectionId
+	}
+	client.OnEntryListCar = func(car network.EntryListCar) { entryListCars <- car }
+	client.OnTrackData = func(data network.TrackData) { trackData <- data }
+	client.OnRealTimeUpdate = func(update network.RealTimeUpdate) {
+		select {
+		case realTimeUpdates <- update:
+		default:
+		}
+	}
+
+	_, done := connect(t, &client, server, connected)
+
+	for i := 0; i < len(server.EntryList); i++ {
+		select {
+		case car := <-entryListCars:
+			if car.TeamName != server.EntryList[car.Id].TeamName {
+				t.Errorf("unexpected entry-list car: %+v", car)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("OnEntryListCar not called for every car")
+		}
+	}
+
+	select {
+	case data := <-trackData:
+		if data.Name != network.TrackNameSpa || data.Meters != 7004 || len(data.CameraSets["Onboard"]) != 2 || len(data.HUDPages) != 2 {
+			t.Errorf("unexpected track-data: %+v", data)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("OnTrackData not called")
+	}
+
+	select {
+	case <-realTimeUpdates:
+	case <-time.After(testTimeout):
+		t.Fatal("OnRealTimeUpdate not called")
+	}
+
+	client.RequestDisconnect()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("disconnect on request reported failure: %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("client did not stop after RequestDisconnect")
+	}
+	if _, ok := server.WaitForCommand(network.UnregisterCommandApplication, 1, testTimeout); !ok {
+		t.Error("unregister not received by ACC")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	client := network.Client{EventBufferSize: 16, EventOverflow: network.OverflowDropOldest}
+	events := client.Events()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(ctx, network.Config{Address: server.Addr(), ConnectionPassword: "asd", RealtimeUpdateIntervalMs: 20, TimeoutMs: 1000})
+	}()
+
+	received := make(map[string]int)
+	timeout := time.After(testTimeout)
+	for received["entryListCar"] < len(server.EntryList) || received["realTimeUpdate"] == 0 {
+		select {
+		case event := <-events:
+			switch event := event.(type) {
+			case network.Connected:
+				if received["connected"] > 0 || event.ReadOnly {
+					t.Errorf("unexpected connected event: %+v", event)
+				}
+				received["connected"]++
+				client.RequestEntryList()
+			case network.RealTimeUpdate:
+				received["realTimeUpdate"]++
+			case network.EntryList:
+				received["entryList"]++
+			case network.EntryListCar:
+				if received["entryList"] == 0 {
+					t.Error("entry-list car received before entry-list")
+				}
+				received["entryListCar"]++
+			}
+		case <-timeout:
+			t.Fatalf("not all expected events received: %v", received)
+		}
+	}
+
+	cancel()
+	<-done
+	for {
+		select {
+		case event := <-events:
+			if _, ok := event.(network.Disconnected); !ok {
+				continue
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("no disconnected event")
+		}
+		break
+	}
+}
+
+func TestRunReturnsWithFullEvents(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	for _, test := range []struct {
+		name     string
+		cancel   bool // cancel the context, otherwise Run stops due to a read-timeout
+		expected error
+	}{
+		{"cancel", true, context.Canceled},
+		{"read-timeout", false, network.ErrReadTimeout},
+	} {
+		// the Connected event fills the channel which is never read
+		client := network.Client{EventBufferSize: 1, EventOverflow: network.OverflowBlock}
+		events := client.Events()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Run(ctx, network.Config{Address: server.Addr(), ConnectionPassword: "asd", RealtimeUpdateIntervalMs: 60000, TimeoutMs: 200})
+		}()
+
+		deadline := time.Now().Add(testTimeout)
+		for len(events) < cap(events) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if test.cancel {
+			cancel()
+		}
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, test.expected) {
+				t.Errorf("%s: expected %v but got %v", test.name, test.expected, err)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%s: Run did not return while the events channel was full", test.name)
+		}
+		cancel()
+	}
+}
+
+func TestGateOnEntryList(t *testing.T) {
+	joiningCar := network.EntryListCar{Id: 2, TeamName: "Team C", RaceNumber: 99}
+	server := startServer(t, func(server *acctest.Server) {
+		server.Frames = []acctest.Frame{{CarUpdates: []network.RealTimeCarUpdate{{Id: 0}, {Id: 1}, {Id: joiningCar.Id}}}}
+	})
+	defer server.Close()
+
+	var mutex sync.Mutex
+	var calls []string
+	called := func(call string) {
+		mutex.Lock()
+		calls = append(calls, call)
+		mutex.Unlock()
+	}
+	joined := make(chan network.EntryListCar, 1)
+	connected := make(chan int32, 1)
+
+	client := network.Client{
+		GateOnEntryList:          true,
+		EntryListRequestInterval: 200 * time.Millisecond,
+	}
+	client.OnConnected = func(connectionId int32) {
+		client.RequestEntryList()
+		connected <- connectionId
+	}
+	client.OnEntryListCar = func(car network.EntryListCar) { called(fmt.Sprintf("car %d", car.Id)) }
+	client.OnRealTimeCarUpdate = func(update network.RealTimeCarUpdate) { called(fmt.Sprintf("update %d", update.Id)) }
+	client.OnCarJoined = func(car network.EntryListCar) {
+		called(fmt.Sprintf("joined %d", car.Id))
+		joined <- car
+	}
+
+	start := time.Now()
+	_, done := connect(t, &client, server, connected)
+	time.Sleep(500 * time.Millisecond)
+	server.SetEntryList(append(server.EntryList[:2:2], joiningCar))
+
+	select {
+	case car := <-joined:
+		if car.RaceNumber != joiningCar.RaceNumber {
+			t.Errorf("unexpected car joined: %+v", car)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("OnCarJoined not called")
+	}
+	client.RequestDisconnect()
+	<-done
+	elapsed := time.Since(start)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	seen := make(map[string]bool)
+	for i, call := range calls {
+		switch call {
+		case "update 0", "update 1", "update 2":
+			if car := "car" + call[len("update"):]; !seen[car] {
+				t.Fatalf("%s before %s: %v", call, car, calls[:i+1])
+			}
+		case "joined 2":
+			if calls[i-1] != "car 2" || seen["joined 2"] {
+				t.Errorf("OnCarJoined not called once right after OnEntryListCar: %v", calls[:i+1])
+			}
+		case "joined 0", "joined 1":
+			t.Errorf("%s called for car of the initial entry-list", call)
+		}
+		seen[call] = true
+	}
+
+	requests := 0
+	for _, command := range server.Commands() {
+		if command.Type == network.RequestEntryList {
+			requests++
+		}
+	}
+	if max := 2 + int(elapsed/client.EntryListRequestInterval); requests < 2 || requests > max {
+		t.Errorf("expected between 2 and %d entry-list requests but got %d", max, requests)
+	}
+	if client.DroppedCarUpdates() == 0 {
+		t.Error("superseded updates of the unknown car not counted")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	var capture bytes.Buffer
+	captureWriter, err := network.NewCaptureWriter(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connected := make(chan int32, 1)
+	client := network.Client{Recorder: captureWriter, OnConnected: func(connectionId int32) { connected <- connectionId }}
+	_, done := connect(t, &client, server, connected)
+	client.RequestDisconnect()
+	<-done
+	captureWriter.Flush()
+
+	captureReader, err := network.NewCaptureReader(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgTypes []byte
+	var directions []network.Direction
+	for {
+		record, err := captureReader.Next()
+		if err != nil {
+			break
+		}
+		msgTypes = append(msgTypes, record.Datagram[0])
+		directions = append(directions, record.Direction)
+	}
+	last := len(msgTypes) - 1
+	if len(msgTypes) < 3 ||
+		msgTypes[0] != network.RegisterCommandApplication || directions[0] != network.Outbound ||
+		msgTypes[1] != network.RegistrationResultMsgType || directions[1] != network.Inbound ||
+		msgTypes[last] != network.UnregisterCommandApplication || directions[last] != network.Outbound {
+		t.Errorf("unexpected capture: types %v, directions %v", msgTypes, directions)
+	}
+}
+
+// outboundRecorder keeps the message-types of the datagrams send to ACC
+type outboundRecorder struct {
+	mutex    sync.Mutex
+	msgTypes []byte
+}
+
+func (recorder *outboundRecorder) Record(direction network.Direction, datagram []byte) {
+	if direction == network.Outbound {
+		recorder.mutex.Lock()
+		recorder.msgTypes = append(recorder.msgTypes, datagram[0])
+		recorder.mutex.Unlock()
+	}
+}
+
+func (recorder *outboundRecorder) count(msgType byte) (n int) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	for _, t := range recorder.msgTypes {
+		if t == msgType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestNoUnregisterWithoutRegistration(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	connected := make(chan int32, 1)
+	var recorder outboundRecorder
+	client := network.Client{Recorder: &recorder, OnConnected: func(connectionId int32) { connected <- connectionId }}
+	_, done := connect(t, &client, server, connected)
+	client.RequestDisconnect()
+	<-done
+
+	// the registration is not answered, thus the connection-id of the previous connection may not be used
+	server.SetMuted(true)
+	err := client.Run(context.Background(), network.Config{Address: server.Addr(), ConnectionPassword: "asd", TimeoutMs: 100})
+	if !errors.Is(err, network.ErrReadTimeout) {
+		t.Errorf("expected ErrReadTimeout but got %v", err)
+	}
+	if n := recorder.count(network.UnregisterCommandApplication); n != 1 {
+		t.Errorf("expected only the first connection to be unregistered, got %d unregisters", n)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	connected := make(chan int32, 1)
+	client := network.Client{OnConnected: func(connectionId int32) { connected <- connectionId }}
+
+	previousConnectionId := int32(-1)
+	for i := 0; i < 3; i++ {
+		connectionId, done := connect(t, &client, server, connected)
+		if connectionId == previousConnectionId {
+			t.Errorf("connection-id %d reused", connectionId)
+		}
+		previousConnectionId = connectionId
+
+		client.RequestDisconnect()
+		select {
+		case <-done:
+		case <-time.After(testTimeout):
+			t.Fatal("client did not stop after RequestDisconnect")
+		}
+		if _, ok := server.WaitForCommand(network.UnregisterCommandApplication, i+1, testTimeout); !ok {
+			t.Fatal("unregister not received by ACC")
+		}
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	connected := make(chan int32, 1)
+	client := network.Client{OnConnected: func(connectionId int32) { connected <- connectionId }}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		// with a timeout this long, a return within testTimeout proves the read got unblocked by the cancel
+		done <- client.Run(ctx, network.Config{Address: server.Addr(), ConnectionPassword: "asd", RealtimeUpdateIntervalMs: 1000, TimeoutMs: 60000})
+	}()
+
+	select {
+	case <-connected:
+	case <-time.After(testTimeout):
+		t.Fatal("OnConnected not called")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled but got %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Run did not return after cancelling the context")
+	}
+	if _, ok := server.WaitForCommand(network.UnregisterCommandApplication, 1, testTimeout); !ok {
+		t.Error("unregister not received by ACC")
+	}
+	if err := client.RequestEntryList(); !errors.Is(err, network.ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected but got %v", err)
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	// a previous connection was established
+	connected := make(chan int32, 1)
+	disconnected := make(chan bool, 2)
+	var recorder outboundRecorder
+	client := network.Client{
+		Recorder:       &recorder,
+		OnConnected:    func(connectionId int32) { connected <- connectionId },
+		OnDisconnected: func() { disconnected <- true },
+	}
+	events := client.Events()
+	_, done := connect(t, &client, server, connected)
+	client.RequestDisconnect()
+	<-done
+	<-disconnected
+	for len(events) > 0 {
+		<-events
+	}
+
+	err := client.Run(context.Background(), network.Config{Address: server.Addr(), ConnectionPassword: "wrong", TimeoutMs: 1000})
+	if !errors.Is(err, network.ErrRegistrationRejected) || network.IsRetryable(err) {
+		t.Errorf("expected permanent ErrRegistrationRejected but got %v", err)
+	}
+	select {
+	case <-connected:
+		t.Error("OnConnected called while registration was rejected")
+	default:
+	}
+	select {
+	case <-disconnected:
+		t.Error("OnDisconnected called while registration was rejected")
+	default:
+	}
+	if len(events) > 0 {
+		t.Errorf("unexpected event while registration was rejected: %+v", <-events)
+	}
+	if n := recorder.count(network.UnregisterCommandApplication); n != 1 {
+		t.Errorf("rejected registration unregistered with the previous connection-id (%d unregisters)", n)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	server := startServer(t, func(server *acctest.Server) { server.CommandPassword = "cmd" })
+	defer server.Close()
+
+	for _, commandPassword := range []string{"", "cmd"} {
+		commandErr := make(chan error, 1)
+		var client network.Client
+		client.OnConnected = func(connectionId int32) {
+			commandErr <- client.RequestFocus(1, "", "")
+			client.RequestDisconnect()
+		}
+		client.Run(context.Background(), network.Config{Address: server.Addr(), ConnectionPassword: "asd", CommandPassword: commandPassword, TimeoutMs: 1000})
+
+		err := <-commandErr
+		if commandPassword == server.CommandPassword {
+			if client.IsReadOnly() || err != nil {
+				t.Errorf("command refused with correct command-password: %v", err)
+			}
+		} else if !client.IsReadOnly() || !errors.Is(err, network.ErrReadOnly) {
+			t.Errorf("expected ErrReadOnly without command-password but got %v", err)
+		}
+	}
+
+	if _, ok := server.WaitForCommand(network.ChangeFocus, 1, testTimeout); !ok {
+		t.Error("focus-req not received by ACC")
+	}
+	if len(server.Commands()) != 5 { // 2x registration, 2x unregister and 1x focus
+		t.Errorf("unexpected commands received by ACC: %+v", server.Commands())
+	}
+}
+
+func TestAddressNotResolved(t *testing.T) {
+	var client network.Client
+	err := client.Run(context.Background(), network.Config{Address: "not-an-address", TimeoutMs: 100})
+
+	var clientErr *network.Error
+	if !errors.As(err, &clientErr) || clientErr.Code != network.ErrorAddressNotResolved || clientErr.Unwrap() == nil {
+		t.Errorf("expected ErrorAddressNotResolved wrapping the resolve error but got %v", err)
+	}
+	if network.IsRetryable(err) {
+		t.Error("unresolvable address should not be retried")
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+
+	connected := make(chan int32, 1)
+	disconnected := make(chan bool, 1)
+	client := network.Client{
+		OnConnected:    func(connectionId int32) { connected <- connectionId },
+		OnDisconnected: func() { disconnected <- true },
+	}
+
+	_, done := connect(t, &client, server, connected)
+	server.SetMuted(true)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, network.ErrReadTimeout) || !network.IsRetryable(err) {
+			t.Errorf("expected retryable read-timeout but got %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("client did not stop after ACC stopped responding")
+	}
+	select {
+	case <-disconnected:
+	default:
+		t.Error("OnDisconnected not called")
+	}
+}
@@ -0,0 +1,291 @@
+package network
+
+import (
+	"sync"
+)
+
+// DefaultQueueSize is used when no queue size is passed to NewDispatcher
+const DefaultQueueSize = 64
+
+// Queue identifies a queue of a Dispatcher, there is one queue per callback of the Client
+// (except for OnConnected and OnDisconnected that share QueueConnection)
+type Queue int
+
+const (
+	QueueConnection        Queue = iota // OnConnected and OnDisconnected
+	QueueRealTimeUpdate                 // OnRealTimeUpdate, bounded
+	QueueRealTimeCarUpdate              // OnRealTimeCarUpdate, bounded and coalesced
+	QueueBroadCastEvent                 // OnBroadCastEvent
+	QueueEntryList                      // OnEntryList
+	QueueEntryListCar                   // OnEntryListCar
+	QueueTrackData                      // OnTrackData
+	QueueCarJoined                      // OnCarJoined
+)
+
+// bounded returns true for the queues of the realtime updates, of which messages can be dropped as these are
+// superseded by the next update anyway. Broadcast events are not, as each event (e.g. a completed lap) is only
+// send once.
+func (queue Queue) bounded() bool {
+	return queue == QueueRealTimeUpdate || queue == QueueRealTimeCarUpdate
+}
+
+// QueueStats reports the state of one queue of a Dispatcher
+type QueueStats struct {
+	Depth     int    // number of messages waiting to be handled
+	Dropped   uint64 // messages dropped because the queue was full
+	Coalesced uint64 // car updates replaced by a more recent update of the same car before being handled
+}
+
+// Dispatcher decouples reading from the connection from calling the callbacks of a Client, such that a slow
+// callback (e.g. writing to a database) does not delay reading and does not result in ErrReadTimeout.
+//
+// The messages are queued in a queue per callback and the callbacks are called from a separate go-routine, in the
+// order the messages were received. Only the queues of the realtime updates (RealTimeUpdate and RealTimeCarUpdate)
+// are bounded: once such a queue is full, new updates of that type are dropped. A RealTimeCarUpdate that is still
+// queued when a more recent update of the same car arrives is replaced by the recent one.
+// The connection events, broadcast events and state messages (entry-list, track data, ...) are never dropped.
+type Dispatcher struct {
+	client    *Client
+	queueSize int
+	callbacks callbacks
+
+	mutex       sync.Mutex
+	seq         uint64
+	queues      map[Queue][]*dispatchItem
+	stats       map[Queue]*QueueStats
+	pendingCars map[uint16]*dispatchItem
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// callbacks of the Client that are wrapped by the Dispatcher
+type callbacks struct {
+	onConnected         func(connectionId int32)
+	onDisconnected      func()
+	onRealTimeUpdate    func(RealTimeUpdate)
+	onRealTimeCarUpdate func(RealTimeCarUpdate)
+	onBroadCastEvent    func(BroadCastEvent)
+	onEntryList         func(EntryList)
+	onEntryListCar      func(EntryListCar)
+	onTrackData         func(TrackData)
+	onCarJoined         func(EntryListCar)
+}
+
+type dispatchItem struct {
+	seq  uint64
+	call func()
+
+	// carUpdate is set for car updates such that a queued update can be replaced by a more recent one
+	carUpdate *RealTimeCarUpdate
+}
+
+// NewDispatcher replaces the callbacks of the client by callbacks that queue the messages and starts calling
+// the original callbacks from a separate go-routine. If queueSize is 0, DefaultQueueSize is used.
+//
+// The callbacks of the client need to be set before calling NewDispatcher. Close restores the callbacks.
+func NewDispatcher(client *Client, queueSize int) *Dispatcher {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	dispatcher := &Dispatcher{
+		client:    client,
+		queueSize: queueSize,
+		callbacks: callbacks{
+			onConnected:         client.OnConnected,
+			onDisconnected:      client.OnDisconnected,
+			onRealTimeUpdate:    client.OnRealTimeUpdate,
+			onRealTimeCarUpdate: client.OnRealTimeCarUpdate,
+			onBroadCastEvent:    client.OnBroadCastEvent,
+			onEntryList:         client.OnEntryList,
+			onEntryListCar:      client.OnEntryListCar,
+			onTrackData:         client.OnTrackData,
+			onCarJoined:         client.OnCarJoined,
+		},
+		queues:      make(map[Queue][]*dispatchItem),
+		stats:       make(map[Queue]*QueueStats),
+		pendingCars: make(map[uint16]*dispatchItem),
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	c := dispatcher.callbacks
+	if c.onConnected != nil {
+		client.OnConnected = func(connectionId int32) {
+			dispatcher.enqueue(QueueConnection, func() { c.onConnected(connectionId) })
+		}
+	}
+	if c.onDisconnected != nil {
+		client.OnDisconnected = func() {
+			dispatcher.enqueue(QueueConnection, c.onDisconnected)
+		}
+	}
+	if c.onRealTimeUpdate != nil {
+		client.OnRealTimeUpdate = func(update RealTimeUpdate) {
+			dispatcher.enqueue(QueueRealTimeUpdate, func() { c.onRealTimeUpdate(update) })
+		}
+	}
+	if c.onRealTimeCarUpdate != nil {
+		client.OnRealTimeCarUpdate = dispatcher.enqueueCarUpdate
+	}
+	if c.onBroadCastEvent != nil {
+		client.OnBroadCastEvent = func(event BroadCastEvent) {
+			dispatcher.enqueue(QueueBroadCastEvent, func() { c.onBroadCastEvent(event) })
+		}
+	}
+	if c.onEntryList != nil {
+		client.OnEntryList = func(entryList EntryList) {
+			dispatcher.enqueue(QueueEntryList, func() { c.onEntryList(entryList) })
+		}
+	}
+	if c.onEntryListCar != nil {
+		client.OnEntryListCar = func(car EntryListCar) {
+			dispatcher.enqueue(QueueEntryListCar, func() { c.onEntryListCar(car) })
+		}
+	}
+	if c.onTrackData != nil {
+		client.OnTrackData = func(trackData TrackData) {
+			dispatcher.enqueue(QueueTrackData, func() { c.onTrackData(trackData) })
+		}
+	}
+	if c.onCarJoined != nil {
+		client.OnCarJoined = func(car EntryListCar) {
+			dispatcher.enqueue(QueueCarJoined, func() { c.onCarJoined(car) })
+		}
+	}
+
+	go dispatcher.run()
+	return dispatcher
+}
+
+// Close stops calling the callbacks and restores the original callbacks of the Client.
+// Messages that are still queued are not handled anymore. Close should not be called while the Client is running.
+func (dispatcher *Dispatcher) Close() {
+	close(dispatcher.done)
+	<-dispatcher.stopped
+
+	client, c := dispatcher.client, dispatcher.callbacks
+	client.OnConnected = c.onConnected
+	client.OnDisconnected = c.onDisconnected
+	client.OnRealTimeUpdate = c.onRealTimeUpdate
+	client.OnRealTimeCarUpdate = c.onRealTimeCarUpdate
+	client.OnBroadCastEvent = c.onBroadCastEvent
+	client.OnEntryList = c.onEntryList
+	client.OnEntryListCar = c.onEntryListCar
+	client.OnTrackData = c.onTrackData
+	client.OnCarJoined = c.onCarJoined
+}
+
+// Stats returns the state of every queue that received a message so far
+func (dispatcher *Dispatcher) Stats() map[Queue]QueueStats {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	stats := make(map[Queue]QueueStats, len(dispatcher.stats))
+	for queue, s := range dispatcher.stats {
+		stats[queue] = *s
+	}
+	return stats
+}
+
+func (dispatcher *Dispatcher) enqueue(queue Queue, call func()) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	dispatcher.push(queue, &dispatchItem{call: call})
+}
+
+func (dispatcher *Dispatcher) enqueueCarUpdate(update RealTimeCarUpdate) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	if item, found := dispatcher.pendingCars[update.Id]; found {
+		*item.carUpdate = update
+		dispatcher.stat(QueueRealTimeCarUpdate).Coalesced++
+		return
+	}
+
+	item := &dispatchItem{carUpdate: &update}
+	item.call = func() { dispatcher.callbacks.onRealTimeCarUpdate(*item.carUpdate) }
+	if dispatcher.push(QueueRealTimeCarUpdate, item) {
+		dispatcher.pendingCars[update.Id] = item
+	}
+}
+
+// push adds the item to the queue, returns false if dropped because a bounded queue is full.
+// The mutex needs to be locked.
+func (dispatcher *Dispatcher) push(queue Queue, item *dispatchItem) bool {
+	stat := dispatcher.stat(queue)
+	if queue.bounded() && len(dispatcher.queues[queue]) >= dispatcher.queueSize {
+		stat.Dropped++
+		return false
+	}
+
+	dispatcher.seq++
+	item.seq = dispatcher.seq
+	dispatcher.queues[queue] = append(dispatcher.queues[queue], item)
+	stat.Depth++
+
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// stat returns the stats of the queue. The mutex needs to be locked.
+func (dispatcher *Dispatcher) stat(queue Queue) *QueueStats {
+	stat, found := dispatcher.stats[queue]
+	if !found {
+		stat = &QueueStats{}
+		dispatcher.stats[queue] = stat
+	}
+	return stat
+}
+
+// pop removes the oldest item over all queues, returns nil if all queues are empty
+func (dispatcher *Dispatcher) pop() *dispatchItem {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	var oldest *dispatchItem
+	var oldestQueue Queue
+	for queue, items := range dispatcher.queues {
+		if len(items) > 0 && (oldest == nil || items[0].seq < oldest.seq) {
+			oldest, oldestQueue = items[0], queue
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+
+	items := dispatcher.queues[oldestQueue]
+	items[0] = nil
+	dispatcher.queues[oldestQueue] = items[1:]
+	dispatcher.stat(oldestQueue).Depth--
+	if oldest.carUpdate != nil {
+		delete(dispatcher.pendingCars, oldest.carUpdate.Id)
+	}
+	return oldest
+}
+
+func (dispatcher *Dispatcher) run() {
+	defer close(dispatcher.stopped)
+	for {
+		select {
+		case <-dispatcher.done:
+			return
+		case <-dispatcher.wake:
+		}
+
+		for item := dispatcher.pop(); item != nil; item = dispatcher.pop() {
+			item.call()
+			select {
+			case <-dispatcher.done:
+				return
+			default:
+			}
+		}
+	}
+}
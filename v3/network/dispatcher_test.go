@@ -0,0 +1,134 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 100)
+	client := Client{
+		OnRealTimeUpdate: func(update RealTimeUpdate) {
+			<-release
+			handled <- "update"
+		},
+		OnRealTimeCarUpdate: func(update RealTimeCarUpdate) { handled <- "car " + string('0'+rune(update.Laps)) },
+		OnEntryList:         func(EntryList) { handled <- "entry-list" },
+	}
+	dispatcher := NewDispatcher(&client, 3)
+
+	// the first update blocks the dispatcher while the client continues
+	client.OnRealTimeUpdate(RealTimeUpdate{})
+	start := time.Now()
+	for dispatcher.Stats()[QueueRealTimeUpdate].Depth != 0 {
+		if time.Since(start) > time.Second {
+			t.Fatal("first update not picked up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	client.OnRealTimeCarUpdate(RealTimeCarUpdate{Id: 0, Laps: 1})
+	client.OnRealTimeCarUpdate(RealTimeCarUpdate{Id: 1, Laps: 1})
+	client.OnEntryList(EntryList{0, 1})
+	client.OnRealTimeCarUpdate(RealTimeCarUpdate{Id: 0, Laps: 2})
+	for i := 0; i < 5; i++ {
+		client.OnRealTimeUpdate(RealTimeUpdate{})
+	}
+
+	stats := dispatcher.Stats()
+	if stats[QueueRealTimeCarUpdate] != (QueueStats{Depth: 2, Coalesced: 1}) {
+		t.Errorf("unexpected stats of car updates: %+v", stats[QueueRealTimeCarUpdate])
+	}
+	if stats[QueueRealTimeUpdate] != (QueueStats{Depth: 3, Dropped: 2}) {
+		t.Errorf("unexpected stats of updates: %+v", stats[QueueRealTimeUpdate])
+	}
+
+	close(release)
+	var order []string
+	for len(order) < 7 {
+		select {
+		case h := <-handled:
+			order = append(order, h)
+		case <-time.After(time.Second):
+			t.Fatalf("not all messages handled: %v", order)
+		}
+	}
+	expected := []string{"update", "car 2", "car 1", "entry-list", "update", "update", "update"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v but got %v", expected, order)
+	}
+
+	dispatcher.Close()
+	client.OnEntryList(EntryList{})
+	if h := <-handled; h != "entry-list" {
+		t.Errorf("original callback not restored: %s", h)
+	}
+}
+
+func TestDispatcherKeepsStateMessages(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 100)
+	client := Client{
+		OnConnected: func(int32) {
+			<-release
+			handled <- "connected"
+		},
+		OnDisconnected:      func() { handled <- "disconnected" },
+		OnRealTimeUpdate:    func(RealTimeUpdate) { handled <- "update" },
+		OnEntryList:         func(EntryList) { handled <- "entry-list" },
+		OnEntryListCar:      func(EntryListCar) { handled <- "entry-list-car" },
+		OnTrackData:         func(TrackData) { handled <- "track" },
+		OnCarJoined:         func(EntryListCar) { handled <- "joined" },
+		OnBroadCastEvent:    func(BroadCastEvent) { handled <- "event" },
+		OnRealTimeCarUpdate: func(RealTimeCarUpdate) {},
+	}
+	dispatcher := NewDispatcher(&client, 1)
+	defer dispatcher.Close()
+
+	client.OnConnected(1)
+	start := time.Now()
+	for dispatcher.Stats()[QueueConnection].Depth != 0 {
+		if time.Since(start) > time.Second {
+			t.Fatal("connection not picked up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queues are full after the first message, only the realtime updates are dropped, not the broadcast events
+	for i := 0; i < 3; i++ {
+		client.OnRealTimeUpdate(RealTimeUpdate{})
+		client.OnEntryList(EntryList{})
+		client.OnEntryListCar(EntryListCar{})
+		client.OnTrackData(TrackData{})
+		client.OnCarJoined(EntryListCar{})
+		client.OnBroadCastEvent(BroadCastEvent{Type: BroadCastEventTypeLapCompleted})
+	}
+	client.OnDisconnected()
+
+	stats := dispatcher.Stats()
+	if stats[QueueRealTimeUpdate] != (QueueStats{Depth: 1, Dropped: 2}) {
+		t.Errorf("unexpected stats of updates: %+v", stats[QueueRealTimeUpdate])
+	}
+	for _, queue := range []Queue{QueueEntryList, QueueEntryListCar, QueueTrackData, QueueCarJoined, QueueBroadCastEvent} {
+		if stats[queue] != (QueueStats{Depth: 3}) {
+			t.Errorf("unexpected stats of queue %d: %+v", queue, stats[queue])
+		}
+	}
+
+	close(release)
+	counts := make(map[string]int)
+	for i := 0; i < 18; i++ {
+		select {
+		case h := <-handled:
+			counts[h]++
+		case <-time.After(time.Second):
+			t.Fatalf("not all messages handled: %v", counts)
+		}
+	}
+	expected := map[string]int{"connected": 1, "update": 1, "entry-list": 3, "entry-list-car": 3, "track": 3, "joined": 3, "event": 3, "disconnected": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v but got %v", expected, counts)
+	}
+}
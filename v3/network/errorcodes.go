@@ -1,5 +1,7 @@
 package network
 
+import "errors"
+
 const Code = "code"
 
 // The address provided for the UDP interface did not resolve and thus client will stop
@@ -17,3 +19,81 @@ const InfoRegistrationReqSendToAcc = 1004
 
 // ACC acknowledged the registration and has returned a connection-id
 const InfoRegistrationAckByAcc = 1005
+
+// Writing a request to ACC failed
+const ErrorWriteFailed = 1006
+
+// A message received from ACC could not be interpreted. Client will stop.
+const ErrorInvalidMessage = 1007
+
+// A request was made while the client was not connected to ACC
+const ErrorNotConnected = 1008
+
+// A request was not send as it contained invalid arguments
+const ErrorInvalidRequest = 1009
+
+// ACC refused the registration, e.g. due to a wrong connection-password. Client will stop.
+const ErrorRegistrationRejected = 1010
+
+// A command was not send as the connection is read-only (the command-password was not accepted by ACC)
+const ErrorReadOnly = 1011
+
+// Error is returned by the Client. It carries one of the Error<name> codes and wraps the underlying
+// error (e.g. the net.Error) if there is one.
+//
+// Use errors.Is with one of the Err<name> variables to check for a specific code, or errors.As to
+// retrieve the Error itself.
+type Error struct {
+	Code int
+	Msg  string
+	Err  error
+}
+
+var (
+	ErrAddressNotResolved   = &Error{Code: ErrorAddressNotResolved, Msg: "address not resolved"}
+	ErrSetupUDPConnection   = &Error{Code: ErrorSetupUDPConnection, Msg: "UDP connection could not be set up"}
+	ErrReadTimeout          = &Error{Code: ErrorReadTimeout, Msg: "ACC did not respond"}
+	ErrWriteFailed          = &Error{Code: ErrorWriteFailed, Msg: "writing to ACC failed"}
+	ErrInvalidMessage       = &Error{Code: ErrorInvalidMessage, Msg: "message from ACC can not be interpreted"}
+	ErrNotConnected         = &Error{Code: ErrorNotConnected, Msg: "not connected to ACC"}
+	ErrInvalidRequest       = &Error{Code: ErrorInvalidRequest, Msg: "invalid request"}
+	ErrRegistrationRejected = &Error{Code: ErrorRegistrationRejected, Msg: "registration rejected by ACC"}
+	ErrReadOnly             = &Error{Code: ErrorReadOnly, Msg: "connection is read-only"}
+)
+
+func newError(code int, msg string, err error) *Error {
+	return &Error{Code: code, Msg: msg, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is an Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// IsRetryable reports whether connecting again might succeed after the Client stopped with the given error.
+//
+// This is the case if the connection broke (e.g. ACC did not respond in time because it was not running yet
+// or was restarted) but not if the error is due to the configuration (e.g. an address that does not resolve).
+func IsRetryable(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code {
+	case ErrorSetupUDPConnection, ErrorReadTimeout, ErrorWriteFailed, ErrorInvalidMessage:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package network
+
+// Event is received from the channel returned by Client.Events.
+//
+// It is one of Connected, Disconnected, RealTimeUpdate, RealTimeCarUpdate, EntryList, EntryListCar, CarJoined,
+// TrackData or BroadCastEvent, to be distinguished with a type switch. No other types can implement Event.
+type Event interface {
+	isEvent()
+}
+
+// Connected is the Event corresponding to OnConnected
+type Connected struct {
+	ConnectionId int32
+	ReadOnly     bool // see Client.IsReadOnly
+}
+
+// Disconnected is the Event corresponding to OnDisconnected
+type Disconnected struct{}
+
+// CarJoined is the Event corresponding to OnCarJoined, it is only send if Client.GateOnEntryList is set
+type CarJoined struct {
+	Car EntryListCar
+}
+
+func (Connected) isEvent()         {}
+func (Disconnected) isEvent()      {}
+func (RealTimeUpdate) isEvent()    {}
+func (RealTimeCarUpdate) isEvent() {}
+func (EntryList) isEvent()         {}
+func (EntryListCar) isEvent()      {}
+func (CarJoined) isEvent()         {}
+func (TrackData) isEvent()         {}
+func (BroadCastEvent) isEvent()    {}
+
+// OverflowPolicy defines what happens when an Event is to be send while the channel returned by
+// Client.Events is full
+type OverflowPolicy byte
+
+const (
+	// OverflowBlock waits until there is room in the channel. Beware that the Client stops reading from the
+	// connection in the mean time, which results in ErrReadTimeout if the channel is not read for too long.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest removes the oldest event from the channel to make room for the new one
+	OverflowDropOldest
+
+	// OverflowDropNewest drops the new event
+	OverflowDropNewest
+)
+
+// DefaultEventBufferSize is used when Client.EventBufferSize is not set
+const DefaultEventBufferSize = 256
+
+// Events returns a channel on which every message received from ACC is send as an Event, in addition to calling
+// the corresponding callback. Events are only send once Events is called, the same channel is returned at every
+// call. The channel is never closed, as the Client can be run again after it stopped.
+//
+// EventBufferSize and EventOverflow need to be set before calling Events. See DroppedEvents for the number of
+// events that were dropped because the channel was full.
+func (client *Client) Events() <-chan Event {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.events == nil {
+		size := client.EventBufferSize
+		if size <= 0 {
+			size = DefaultEventBufferSize
+		}
+		client.events = make(chan Event, size)
+	}
+	return client.events
+}
+
+// DroppedEvents returns the number of events that were dropped due to the EventOverflow policy
+func (client *Client) DroppedEvents() uint64 {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.droppedEvents
+}
+
+// hasEvents returns true if Events was called
+func (client *Client) hasEvents() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.events != nil
+}
+
+// emit sends the event on the channel returned by Events, if any
+func (client *Client) emit(event Event) {
+	client.mutex.Lock()
+	events, done := client.events, client.eventsDone
+	client.mutex.Unlock()
+	if events == nil {
+		return
+	}
+
+	if client.EventOverflow != OverflowBlock {
+		if dropped := sendEvent(events, event, client.EventOverflow == OverflowDropOldest); dropped > 0 {
+			client.mutex.Lock()
+			client.droppedEvents += dropped
+			client.mutex.Unlock()
+		}
+		return
+	}
+
+	// stop blocking once the Client is stopped
+	select {
+	case events <- event:
+	default:
+		select {
+		case events <- event:
+		case <-done:
+			client.countDroppedEvent()
+		}
+	}
+}
+
+// sendEvent sends the event without blocking, either dropping the event itself or the oldest events in the
+// channel if it is full. The number of dropped events is returned.
+func sendEvent(events chan Event, event Event, dropOldest bool) (dropped uint64) {
+	for {
+		select {
+		case events <- event:
+			return dropped
+		default:
+		}
+		if !dropOldest {
+			return dropped + 1
+		}
+		select {
+		case <-events:
+			dropped++
+		default:
+		}
+	}
+}
+
+func (client *Client) countDroppedEvent() {
+	client.mutex.Lock()
+	client.droppedEvents++
+	client.mutex.Unlock()
+}
+
+// setEventsDone sets the channel that unblocks emit when the Client (or Replayer) stops
+func (client *Client) setEventsDone(done <-chan struct{}) {
+	client.mutex.Lock()
+	client.eventsDone = done
+	client.mutex.Unlock()
+}
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventOverflow(t *testing.T) {
+	for _, test := range []struct {
+		policy   OverflowPolicy
+		expected []uint16
+	}{
+		{OverflowDropNewest, []uint16{0, 1}},
+		{OverflowDropOldest, []uint16{3, 4}},
+	} {
+		client := Client{EventBufferSize: 2, EventOverflow: test.policy}
+		events := client.Events()
+		for i := uint16(0); i < 5; i++ {
+			client.emit(RealTimeCarUpdate{Id: i})
+		}
+
+		var ids []uint16
+		for len(events) > 0 {
+			ids = append(ids, (<-events).(RealTimeCarUpdate).Id)
+		}
+		if !reflect.DeepEqual(ids, test.expected) || client.DroppedEvents() != 3 {
+			t.Errorf("policy %d: expected %v but got %v with %d dropped", test.policy, test.expected, ids, client.DroppedEvents())
+		}
+	}
+}
+
+func TestEventBlockUnblocksWhenStopped(t *testing.T) {
+	client := Client{EventBufferSize: 1}
+	client.Events()
+	done := make(chan struct{})
+	client.setEventsDone(done)
+
+	client.emit(Disconnected{})
+	close(done)
+	client.emit(Disconnected{}) // would block forever if not unblocked by done
+	if client.DroppedEvents() != 1 {
+		t.Errorf("expected 1 dropped event but got %d", client.DroppedEvents())
+	}
+}
@@ -0,0 +1,132 @@
+package network
+
+import (
+	"time"
+)
+
+// DefaultEntryListRequestInterval is used when Client.EntryListRequestInterval is not set
+const DefaultEntryListRequestInterval = time.Second
+
+// entryListGate holds the state to only propagate the updates of cars that are known from the entry-list,
+// see Client.GateOnEntryList.
+//
+// It is only accessed from within dispatch and thus does not need to be protected by the mutex of the Client.
+type entryListGate struct {
+	// entryList is the most recent entry-list or nil if none received yet since connecting
+	entryList EntryList
+
+	// knownCars are the cars in the most recent entry-list for which OnEntryListCar was called
+	knownCars map[uint16]bool
+
+	// joiningCars are the cars in the most recent entry-list that were not in the entry-list before
+	joiningCars map[uint16]bool
+
+	// pendingUpdates contains the most recent update of every car that is not known yet
+	pendingUpdates map[uint16]RealTimeCarUpdate
+
+	lastEntryListRequest time.Time
+}
+
+// DroppedCarUpdates returns the number of RealTimeCarUpdate's that were not propagated because the car was
+// not known yet (see GateOnEntryList). If the updates are buffered, only the updates that are superseded by a
+// more recent update of the same car are counted.
+func (client *Client) DroppedCarUpdates() uint64 {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.droppedCarUpdates
+}
+
+func (client *Client) countDroppedCarUpdate() {
+	client.mutex.Lock()
+	client.droppedCarUpdates++
+	client.mutex.Unlock()
+}
+
+func (client *Client) gateEntryList(entryList EntryList) {
+	gate := &client.gate
+
+	joiningCars := make(map[uint16]bool)
+	knownCars := make(map[uint16]bool)
+	previous := make(map[uint16]bool, len(gate.entryList))
+	for _, carId := range gate.entryList {
+		previous[carId] = true
+	}
+	for _, carId := range entryList {
+		if gate.knownCars[carId] {
+			knownCars[carId] = true
+		}
+		if gate.entryList != nil && !previous[carId] {
+			joiningCars[carId] = true
+		}
+	}
+
+	// an update of a car that is not in the new entry-list will be superseded anyway
+	inEntryList := make(map[uint16]bool, len(entryList))
+	for _, carId := range entryList {
+		inEntryList[carId] = true
+	}
+	for carId := range gate.pendingUpdates {
+		if !inEntryList[carId] {
+			delete(gate.pendingUpdates, carId)
+			client.countDroppedCarUpdate()
+		}
+	}
+
+	gate.entryList = entryList
+	gate.knownCars = knownCars
+	gate.joiningCars = joiningCars
+}
+
+// gateEntryListCar is called after OnEntryListCar
+func (client *Client) gateEntryListCar(car EntryListCar) {
+	gate := &client.gate
+	if gate.knownCars == nil {
+		// entry-list car received without receiving the entry-list first
+		gate.knownCars = make(map[uint16]bool)
+	}
+	gate.knownCars[car.Id] = true
+
+	if gate.joiningCars[car.Id] {
+		delete(gate.joiningCars, car.Id)
+		client.Logger.Info().Msgf("Car %d (#%d) joined", car.Id, car.RaceNumber)
+		if client.OnCarJoined != nil {
+			client.OnCarJoined(car)
+		}
+		client.emit(CarJoined{Car: car})
+	}
+
+	if update, found := gate.pendingUpdates[car.Id]; found {
+		delete(gate.pendingUpdates, car.Id)
+		client.realTimeCarUpdate(update)
+	}
+}
+
+func (client *Client) gateCarUpdate(update RealTimeCarUpdate) {
+	gate := &client.gate
+	if gate.knownCars[update.Id] {
+		client.realTimeCarUpdate(update)
+		return
+	}
+
+	if client.DropUnknownCarUpdates {
+		client.countDroppedCarUpdate()
+	} else {
+		if gate.pendingUpdates == nil {
+			gate.pendingUpdates = make(map[uint16]RealTimeCarUpdate)
+		}
+		if _, found := gate.pendingUpdates[update.Id]; found {
+			client.countDroppedCarUpdate()
+		}
+		gate.pendingUpdates[update.Id] = update
+	}
+
+	interval := client.EntryListRequestInterval
+	if interval <= 0 {
+		interval = DefaultEntryListRequestInterval
+	}
+	if time.Since(gate.lastEntryListRequest) >= interval {
+		client.Logger.Info().Msgf("Car %d unknown, requesting new entry-list", update.Id)
+		gate.lastEntryListRequest = time.Now()
+		client.RequestEntryList()
+	}
+}
@@ -0,0 +1,317 @@
+package network
+
+import (
+	"sync"
+)
+
+// Filter selects the events a Subscription receives, it returns true to receive the event
+type Filter func(event Event) bool
+
+// MessageTypes returns a Filter that passes the events of the given message types.
+// Connected and Disconnected are passed for RegistrationResultMsgType, CarJoined for EntryListCarMsgType.
+func MessageTypes(msgTypes ...InboundMessageTypes) Filter {
+	return func(event Event) bool {
+		msgType := eventMessageType(event)
+		for _, t := range msgTypes {
+			if t == msgType {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Cars returns a Filter that drops the RealTimeCarUpdate, EntryListCar, CarJoined and BroadCastEvent events of all
+// cars except the given ones. Events that are not related to a car are passed.
+func Cars(carIds ...uint16) Filter {
+	return func(event Event) bool {
+		var carId uint16
+		switch e := event.(type) {
+		case RealTimeCarUpdate:
+			carId = e.Id
+		case EntryListCar:
+			carId = e.Id
+		case CarJoined:
+			carId = e.Car.Id
+		case BroadCastEvent:
+			carId = uint16(e.CarId)
+		default:
+			return true
+		}
+		for _, id := range carIds {
+			if id == carId {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func eventMessageType(event Event) InboundMessageTypes {
+	switch event.(type) {
+	case RealTimeUpdate:
+		return RealtimeUpdateMsgType
+	case RealTimeCarUpdate:
+		return RealtimeCarUpdateMsgType
+	case EntryList:
+		return EntryListMsgType
+	case EntryListCar, CarJoined:
+		return EntryListCarMsgType
+	case TrackData:
+		return TrackDataMsgType
+	case BroadCastEvent:
+		return BroadcastingEventMsgType
+	default:
+		return RegistrationResultMsgType
+	}
+}
+
+// SubscriberConfig configures a Subscription of a Hub
+type SubscriberConfig struct {
+	// Filter selects the events to receive, all events are received if nil
+	Filter Filter
+
+	// BufferSize of the channel of the Subscription, DefaultEventBufferSize is used if not set
+	BufferSize int
+
+	// DropOldest removes the oldest event from a full channel to make room for a new one. By default the new
+	// event is dropped. Blocking is not supported as one slow subscriber would hold up all others.
+	DropOldest bool
+
+	// Replay sends the last Connected, TrackData, EntryList and EntryListCar events received by the Hub on
+	// subscribing (as far as they pass the Filter), such that a late subscriber does not need to wait or
+	// request these itself
+	Replay bool
+}
+
+// Hub distributes the messages received by a single Client to any number of subscribers, which can subscribe
+// and unsubscribe at any time, also while the Client is running. Each Subscription has its own Filter and
+// buffered channel.
+//
+// Sending to the subscribers never blocks, events that do not fit in the channel of a Subscription are dropped
+// for that Subscription only. All methods are safe to be called concurrently. The zero value can be used when
+// feeding the Hub with Publish.
+type Hub struct {
+	mutex         sync.Mutex
+	subscriptions map[*Subscription]struct{}
+
+	// cached for Replay
+	connected     *Connected
+	trackData     *TrackData
+	entryList     *EntryList
+	entryListCars map[uint16]EntryListCar
+}
+
+// Subscription receives the events of a Hub until it is unsubscribed
+type Subscription struct {
+	hub        *Hub
+	filter     Filter
+	dropOldest bool
+	events     chan Event
+
+	dropped uint64 // guarded by the mutex of the Hub
+}
+
+// NewHub returns a Hub fed by the callbacks of the client. The existing callbacks of the client remain
+// in use and are called before the subscribers receive the event. NewHub needs to be called before running
+// the client and after setting its callbacks.
+func NewHub(client *Client) *Hub {
+	hub := &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+		entryListCars: make(map[uint16]EntryListCar),
+	}
+
+	onConnected := client.OnConnected
+	client.OnConnected = func(connectionId int32) {
+		if onConnected != nil {
+			onConnected(connectionId)
+		}
+		hub.Publish(Connected{ConnectionId: connectionId, ReadOnly: client.IsReadOnly()})
+	}
+	onDisconnected := client.OnDisconnected
+	client.OnDisconnected = func() {
+		if onDisconnected != nil {
+			onDisconnected()
+		}
+		hub.Publish(Disconnected{})
+	}
+	onRealTimeUpdate := client.OnRealTimeUpdate
+	client.OnRealTimeUpdate = func(update RealTimeUpdate) {
+		if onRealTimeUpdate != nil {
+			onRealTimeUpdate(update)
+		}
+		hub.Publish(update)
+	}
+	onRealTimeCarUpdate := client.OnRealTimeCarUpdate
+	client.OnRealTimeCarUpdate = func(update RealTimeCarUpdate) {
+		if onRealTimeCarUpdate != nil {
+			onRealTimeCarUpdate(update)
+		}
+		hub.Publish(update)
+	}
+	onBroadCastEvent := client.OnBroadCastEvent
+	client.OnBroadCastEvent = func(event BroadCastEvent) {
+		if onBroadCastEvent != nil {
+			onBroadCastEvent(event)
+		}
+		hub.Publish(event)
+	}
+	onEntryList := client.OnEntryList
+	client.OnEntryList = func(entryList EntryList) {
+		if onEntryList != nil {
+			onEntryList(entryList)
+		}
+		hub.Publish(entryList)
+	}
+	onEntryListCar := client.OnEntryListCar
+	client.OnEntryListCar = func(car EntryListCar) {
+		if onEntryListCar != nil {
+			onEntryListCar(car)
+		}
+		hub.Publish(car)
+	}
+	onCarJoined := client.OnCarJoined
+	client.OnCarJoined = func(car EntryListCar) {
+		if onCarJoined != nil {
+			onCarJoined(car)
+		}
+		hub.Publish(CarJoined{Car: car})
+	}
+	onTrackData := client.OnTrackData
+	client.OnTrackData = func(trackData TrackData) {
+		if onTrackData != nil {
+			onTrackData(trackData)
+		}
+		hub.Publish(trackData)
+	}
+
+	return hub
+}
+
+// Subscribe adds a Subscription that receives all events published from now on that pass its Filter
+func (hub *Hub) Subscribe(cfg SubscriberConfig) *Subscription {
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = DefaultEventBufferSize
+	}
+	subscription := &Subscription{
+		hub:        hub,
+		filter:     cfg.Filter,
+		dropOldest: cfg.DropOldest,
+		events:     make(chan Event, size),
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if cfg.Replay {
+		for _, event := range hub.cached() {
+			subscription.send(event)
+		}
+	}
+	if hub.subscriptions == nil {
+		hub.subscriptions = make(map[*Subscription]struct{})
+	}
+	hub.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+// Publish sends the event to all subscribers. It is called by the callbacks installed by NewHub but can also
+// be used to feed a Hub from another source (e.g. Client.Events).
+func (hub *Hub) Publish(event Event) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.cache(event)
+	for subscription := range hub.subscriptions {
+		subscription.send(event)
+	}
+}
+
+// Subscribers returns the number of current subscriptions
+func (hub *Hub) Subscribers() int {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return len(hub.subscriptions)
+}
+
+// cache keeps the events needed for Replay. The mutex needs to be locked.
+func (hub *Hub) cache(event Event) {
+	switch e := event.(type) {
+	case Connected:
+		hub.connected = &e
+	case Disconnected:
+		hub.connected, hub.trackData, hub.entryList = nil, nil, nil
+		hub.entryListCars = make(map[uint16]EntryListCar)
+	case TrackData:
+		hub.trackData = &e
+	case EntryList:
+		hub.entryList = &e
+		// cars that are not part of the new entry list are forgotten
+		entryListCars := make(map[uint16]EntryListCar, len(e))
+		for _, carId := range e {
+			if car, found := hub.entryListCars[carId]; found {
+				entryListCars[carId] = car
+			}
+		}
+		hub.entryListCars = entryListCars
+	case EntryListCar:
+		if hub.entryListCars == nil {
+			hub.entryListCars = make(map[uint16]EntryListCar)
+		}
+		hub.entryListCars[e.Id] = e
+	}
+}
+
+// cached returns the events to replay, in the order they are received from ACC. The mutex needs to be locked.
+func (hub *Hub) cached() (events []Event) {
+	if hub.connected != nil {
+		events = append(events, *hub.connected)
+	}
+	if hub.trackData != nil {
+		events = append(events, *hub.trackData)
+	}
+	if hub.entryList != nil {
+		events = append(events, *hub.entryList)
+		for _, carId := range *hub.entryList {
+			if car, found := hub.entryListCars[carId]; found {
+				events = append(events, car)
+			}
+		}
+	}
+	return events
+}
+
+// Events returns the channel on which the events are received. The channel is closed by Unsubscribe.
+func (subscription *Subscription) Events() <-chan Event {
+	return subscription.events
+}
+
+// Dropped returns the number of events that were dropped because the channel was full
+func (subscription *Subscription) Dropped() uint64 {
+	subscription.hub.mutex.Lock()
+	defer subscription.hub.mutex.Unlock()
+	return subscription.dropped
+}
+
+// Unsubscribe stops the Subscription and closes its channel. Events that are still in the channel can be read.
+// Calling Unsubscribe more than once has no effect.
+func (subscription *Subscription) Unsubscribe() {
+	hub := subscription.hub
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if _, found := hub.subscriptions[subscription]; !found {
+		return
+	}
+	delete(hub.subscriptions, subscription)
+	close(subscription.events)
+}
+
+// send sends the event if it passes the filter. The mutex of the Hub needs to be locked.
+func (subscription *Subscription) send(event Event) {
+	if subscription.filter != nil && !subscription.filter(event) {
+		return
+	}
+	subscription.dropped += sendEvent(subscription.events, event, subscription.dropOldest)
+}
@@ -0,0 +1,129 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	received := 0
+	client := Client{OnRealTimeUpdate: func(RealTimeUpdate) { received++ }}
+	hub := NewHub(&client)
+
+	all := hub.Subscribe(SubscriberConfig{BufferSize: 10})
+	cars := hub.Subscribe(SubscriberConfig{BufferSize: 2, Filter: Cars(1)})
+	small := hub.Subscribe(SubscriberConfig{BufferSize: 1, Filter: MessageTypes(RealtimeUpdateMsgType)})
+
+	client.OnRealTimeUpdate(RealTimeUpdate{SessionIndex: 1})
+	client.OnRealTimeCarUpdate(RealTimeCarUpdate{Id: 1})
+	client.OnRealTimeCarUpdate(RealTimeCarUpdate{Id: 2})
+	client.OnRealTimeUpdate(RealTimeUpdate{SessionIndex: 2})
+
+	if received != 2 {
+		t.Errorf("existing callback called %d times, expected 2", received)
+	}
+	if len(all.Events()) != 4 {
+		t.Errorf("expected 4 events, got %d", len(all.Events()))
+	}
+
+	// events of car 2 are filtered, the others are passed
+	expected := []Event{RealTimeUpdate{SessionIndex: 1}, RealTimeCarUpdate{Id: 1}}
+	for _, e := range expected {
+		if event := <-cars.Events(); !reflect.DeepEqual(event, e) {
+			t.Errorf("expected %#v, got %#v", e, event)
+		}
+	}
+	if cars.Dropped() != 1 {
+		t.Errorf("expected 1 dropped event, got %d", cars.Dropped())
+	}
+
+	// a full buffer only affects its own subscriber
+	if event := <-small.Events(); !reflect.DeepEqual(event, RealTimeUpdate{SessionIndex: 1}) {
+		t.Errorf("expected first update, got %#v", event)
+	}
+	if small.Dropped() != 1 {
+		t.Errorf("expected 1 dropped event, got %d", small.Dropped())
+	}
+
+	small.Unsubscribe()
+	small.Unsubscribe()
+	if _, ok := <-small.Events(); ok {
+		t.Error("channel not closed after Unsubscribe")
+	}
+	if hub.Subscribers() != 2 {
+		t.Errorf("expected 2 subscribers, got %d", hub.Subscribers())
+	}
+	client.OnRealTimeUpdate(RealTimeUpdate{})
+	if len(all.Events()) != 5 {
+		t.Errorf("expected 5 events, got %d", len(all.Events()))
+	}
+}
+
+func TestHubCarJoined(t *testing.T) {
+	var joined []uint16
+	client := Client{OnCarJoined: func(car EntryListCar) { joined = append(joined, car.Id) }}
+	hub := NewHub(&client)
+	cars := hub.Subscribe(SubscriberConfig{BufferSize: 10, Filter: Cars(1)})
+	entryListCars := hub.Subscribe(SubscriberConfig{BufferSize: 10, Filter: MessageTypes(EntryListCarMsgType)})
+
+	client.OnCarJoined(EntryListCar{Id: 1})
+	client.OnCarJoined(EntryListCar{Id: 2})
+
+	if !reflect.DeepEqual(joined, []uint16{1, 2}) {
+		t.Errorf("existing callback not called for every car: %v", joined)
+	}
+	if event := <-cars.Events(); !reflect.DeepEqual(event, CarJoined{Car: EntryListCar{Id: 1}}) || len(cars.Events()) != 0 {
+		t.Errorf("unexpected events for car 1: %#v", event)
+	}
+	if len(entryListCars.Events()) != 2 {
+		t.Errorf("expected 2 events, got %d", len(entryListCars.Events()))
+	}
+}
+
+func TestHubDropOldest(t *testing.T) {
+	var hub Hub
+	subscription := hub.Subscribe(SubscriberConfig{BufferSize: 2, DropOldest: true})
+	for i := uint16(1); i <= 3; i++ {
+		hub.Publish(RealTimeCarUpdate{Id: i})
+	}
+	if subscription.Dropped() != 1 {
+		t.Errorf("expected 1 dropped event, got %d", subscription.Dropped())
+	}
+	if event := <-subscription.Events(); event.(RealTimeCarUpdate).Id != 2 {
+		t.Errorf("expected oldest event to be dropped, got %#v", event)
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	var hub Hub
+	hub.Publish(Connected{ConnectionId: 3})
+	hub.Publish(TrackData{Name: TrackNameSpa})
+	hub.Publish(EntryList{1, 2})
+	hub.Publish(EntryListCar{Id: 2})
+	hub.Publish(EntryListCar{Id: 1})
+	hub.Publish(EntryListCar{Id: 7})
+	hub.Publish(RealTimeUpdate{})
+
+	subscription := hub.Subscribe(SubscriberConfig{Replay: true})
+	expected := []Event{
+		Connected{ConnectionId: 3},
+		TrackData{Name: TrackNameSpa},
+		EntryList{1, 2},
+		EntryListCar{Id: 1},
+		EntryListCar{Id: 2},
+	}
+	if len(subscription.Events()) != len(expected) {
+		t.Fatalf("expected %d replayed events, got %d", len(expected), len(subscription.Events()))
+	}
+	for _, e := range expected {
+		if event := <-subscription.Events(); !reflect.DeepEqual(event, e) {
+			t.Errorf("expected %#v, got %#v", e, event)
+		}
+	}
+
+	hub.Publish(Disconnected{})
+	subscription = hub.Subscribe(SubscriberConfig{Replay: true})
+	if len(subscription.Events()) != 0 {
+		t.Errorf("expected nothing to replay after disconnecting, got %d events", len(subscription.Events()))
+	}
+}
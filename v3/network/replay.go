@@ -0,0 +1,71 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// Replayer feeds the datagrams of a capture (see CaptureWriter) through the callbacks of a Client, exactly as if
+// they were received from ACC. This allows to develop against a recorded session without ACC running.
+//
+// Only the inbound datagrams are replayed. The Client does not need to be (and should not be) connected.
+type Replayer struct {
+	Client *Client
+
+	// Speed multiplies the pacing of the original session, e.g. 2 replays twice as fast as recorded.
+	// If Speed is 0 (or negative), the capture is replayed as fast as possible.
+	Speed float64
+}
+
+// Replay calls the callbacks of the Client for every inbound datagram in the capture.
+//
+// Replay returns nil once the end of the capture is reached, or the error of the context if it is cancelled
+// before. Like the Client, it stops with ErrRegistrationRejected if the capture contains a refused registration.
+func (replayer *Replayer) Replay(ctx context.Context, captureReader *CaptureReader) error {
+	var firstOffset time.Duration
+	var replayStart time.Time
+	first := true
+	replayer.Client.setEventsDone(ctx.Done())
+
+	for {
+		record, err := captureReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if record.Direction != Inbound || len(record.Datagram) == 0 {
+			continue
+		}
+
+		if first {
+			firstOffset = record.Offset
+			replayStart = time.Now()
+			first = false
+		}
+
+		if replayer.Speed > 0 {
+			due := replayStart.Add(time.Duration(float64(record.Offset-firstOffset) / replayer.Speed))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		readBuffer := bytes.NewBuffer(record.Datagram[1:])
+		if err = replayer.Client.dispatch(record.Datagram[0], readBuffer); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package network
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff defines the delay between consecutive attempts to (re)connect.
+// The zero value results in the defaults mentioned below.
+type Backoff struct {
+	Initial    time.Duration // delay before the first retry, defaults to 1s
+	Max        time.Duration // upper bound of the delay, defaults to 30s
+	Multiplier float64       // factor applied to the delay after each failed attempt, defaults to 2
+	Jitter     float64       // fraction of the delay that is randomised, e.g. 0.2 results in +/-20%, clamped to [0,1]
+}
+
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterMutex sync.Mutex
+
+// Delay returns the delay before the given attempt to reconnect (starting at 1)
+func (backoff Backoff) Delay(attempt int) time.Duration {
+	initial := backoff.Initial
+	if initial <= 0 {
+		initial = time.Second
+	}
+	max := backoff.Max
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	multiplier := backoff.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+	if backoff.Jitter > 0 {
+		jitter := math.Min(backoff.Jitter, 1)
+		jitterMutex.Lock()
+		r := jitterRand.Float64()
+		jitterMutex.Unlock()
+		delay *= 1 + jitter*(2*r-1)
+	}
+	return time.Duration(delay)
+}
+
+// Supervisor keeps a Client connected to ACC, reconnecting with a Backoff whenever the connection breaks.
+//
+// Every time the connection is established, the entry-list and track-data are requested again such
+// that OnEntryList, OnEntryListCar and OnTrackData of the Client are called after every (re)connect.
+type Supervisor struct {
+	Client  *Client
+	Backoff Backoff
+
+	// OnReconnecting is called when the connection could not be established or broke, before waiting
+	// for the delay. The attempt counts the consecutive attempts since the last successful connection (starting at 1).
+	OnReconnecting func(attempt int, delay time.Duration, err error)
+
+	// OnConnected is called when ACC accepted the registration, before the OnConnected of the Client.
+	// The attempt is 0 for the initial connection and counts the reconnection attempts otherwise.
+	OnConnected func(connectionId int32, attempt int)
+}
+
+// Run connects the Client and keeps it connected until the context is cancelled or the Client stops with an
+// error that is not retryable (see IsRetryable).
+//
+// The error of the context is returned in case it is cancelled, otherwise the error that stopped the Client.
+//
+// While running, the OnConnected of the Client is replaced by a callback that calls the OnConnected of the
+// Supervisor and then the original one. The original OnConnected is restored when Run returns, such that the
+// Client can be reused.
+func (supervisor *Supervisor) Run(ctx context.Context, cfg Config) error {
+	client := supervisor.Client
+	onConnected := client.OnConnected
+	defer func() { client.OnConnected = onConnected }()
+
+	attempt := 0
+	client.OnConnected = func(connectionId int32) {
+		if supervisor.OnConnected != nil {
+			supervisor.OnConnected(connectionId, attempt)
+		}
+		attempt = 0
+		client.RequestEntryList()
+		client.RequestTrackData()
+		if onConnected != nil {
+			onConnected(connectionId)
+		}
+	}
+
+	for {
+		err := client.Run(ctx, cfg)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !IsRetryable(err) {
+			client.Logger.Error().Msgf("Not reconnecting to ACC: %v", err)
+			return err
+		}
+
+		attempt++
+		delay := supervisor.Backoff.Delay(attempt)
+		client.Logger.Info().Msgf("Reconnecting to ACC in %v (attempt %d): %v", delay, attempt, err)
+		if supervisor.OnReconnecting != nil {
+			supervisor.OnReconnecting(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
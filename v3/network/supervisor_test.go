@@ -0,0 +1,117 @@
+package network_test
+
+import (
+	"context"
+	"errors"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := network.Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, delay := range expected {
+		if actual := backoff.Delay(i + 1); actual != delay {
+			t.Errorf("attempt %d: expected %v but got %v", i+1, delay, actual)
+		}
+	}
+
+	backoff.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := backoff.Delay(1); delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("delay %v outside of jitter range", delay)
+		}
+	}
+
+	backoff.Jitter = 3
+	for i := 0; i < 100; i++ {
+		if delay := backoff.Delay(1); delay < 0 || delay > 200*time.Millisecond {
+			t.Fatalf("delay %v outside of clamped jitter range", delay)
+		}
+	}
+}
+
+func TestSupervisorReconnects(t *testing.T) {
+	server := startServer(t)
+	defer server.Close()
+	server.SetMuted(true)
+
+	type connection struct {
+		connectionId int32
+		attempt      int
+	}
+	connected := make(chan connection, 10)
+	reconnecting := make(chan int, 100)
+	entryListCars := make(chan network.EntryListCar, 100)
+
+	supervisor := network.Supervisor{
+		Client:         &network.Client{OnEntryListCar: func(car network.EntryListCar) { entryListCars <- car }},
+		Backoff:        network.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond},
+		OnReconnecting: func(attempt int, delay time.Duration, err error) { reconnecting <- attempt },
+		OnConnected:    func(connectionId int32, attempt int) { connected <- connection{connectionId, attempt} },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- supervisor.Run(ctx, network.Config{Address: server.Addr(), ConnectionPassword: "asd", RealtimeUpdateIntervalMs: 20, TimeoutMs: 100})
+	}()
+
+	for expected := 1; expected <= 2; expected++ {
+		select {
+		case attempt := <-reconnecting:
+			if attempt != expected {
+				t.Errorf("expected attempt %d but got %d", expected, attempt)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("OnReconnecting not called while ACC is not responding")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		server.SetMuted(false)
+		select {
+		case c := <-connected:
+			if c.attempt == 0 {
+				t.Error("reconnection reported as initial connection")
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("OnConnected not called once ACC responds")
+		}
+		for range server.EntryList {
+			select {
+			case <-entryListCars:
+			case <-time.After(testTimeout):
+				t.Fatal("entry-list not requested after connecting")
+			}
+		}
+		server.SetMuted(true)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled but got %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("supervisor did not stop after cancelling")
+	}
+}
+
+func TestSupervisorStopsOnPermanentError(t *testing.T) {
+	connected, supervised := false, false
+	client := &network.Client{OnConnected: func(int32) { connected = true }}
+	supervisor := network.Supervisor{Client: client, OnConnected: func(int32, int) { supervised = true }}
+	err := supervisor.Run(context.Background(), network.Config{Address: "not-an-address", TimeoutMs: 100})
+	if network.IsRetryable(err) || err == nil {
+		t.Errorf("expected permanent error but got %v", err)
+	}
+
+	// the OnConnected of the client is restored
+	client.OnConnected(0)
+	if !connected || supervised {
+		t.Error("OnConnected of the client not restored after Run")
+	}
+}
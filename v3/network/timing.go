@@ -0,0 +1,64 @@
+package network
+
+import (
+	"time"
+)
+
+// The protocol expresses time in different units, the methods below convert them all to time.Duration
+
+// Milliseconds converts the (float) milliseconds used throughout the protocol to a time.Duration
+func Milliseconds(ms float32) time.Duration {
+	return time.Duration(float64(ms) * float64(time.Millisecond))
+}
+
+// SessionTimeDuration returns the time since the session started
+func (update RealTimeUpdate) SessionTimeDuration() time.Duration {
+	return Milliseconds(update.SessionTime)
+}
+
+// SessionEndTimeDuration returns the remaining duration of the session
+func (update RealTimeUpdate) SessionEndTimeDuration() time.Duration {
+	return Milliseconds(update.SessionEndTime)
+}
+
+// TimeOfDayDuration returns the time since midnight in the simulation, subject to the race-time-multiplier
+func (update RealTimeUpdate) TimeOfDayDuration() time.Duration {
+	return time.Duration(float64(update.TimeOfDay) * float64(time.Second))
+}
+
+// ReplayTimeDuration returns the session-time that is currently shown in the replay
+func (update RealTimeUpdate) ReplayTimeDuration() time.Duration {
+	return Milliseconds(update.ReplayTime)
+}
+
+// ReplayRemainingDuration returns the time remaining before the replay ends
+func (update RealTimeUpdate) ReplayRemainingDuration() time.Duration {
+	return Milliseconds(update.ReplayRemaining)
+}
+
+// DeltaDuration returns the delta in respect to the fastest lap of the car
+func (update RealTimeCarUpdate) DeltaDuration() time.Duration {
+	return time.Duration(update.Delta) * time.Millisecond
+}
+
+// LapTime returns the lap-time
+func (lap Lap) LapTime() time.Duration {
+	return time.Duration(lap.LapTimeMs) * time.Millisecond
+}
+
+// SplitTimes returns the sector times, a sector time is 0 if the sector was invalid
+func (lap Lap) SplitTimes() []time.Duration {
+	splits := make([]time.Duration, len(lap.Splits))
+	for i, split := range lap.Splits {
+		if split != InvalidSectorTime {
+			splits[i] = time.Duration(split) * time.Millisecond
+		}
+	}
+	return splits
+}
+
+// Time returns the time of the event since the connection was established (not since the session started),
+// see state.Clock to convert it into session-time
+func (event BroadCastEvent) Time() time.Duration {
+	return time.Duration(event.TimeMs) * time.Millisecond
+}
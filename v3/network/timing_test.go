@@ -0,0 +1,32 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTiming(t *testing.T) {
+	update := RealTimeUpdate{SessionTime: 61500.5, SessionEndTime: 1000, TimeOfDay: 3600 * 14.5}
+	if d := update.SessionTimeDuration(); d != 61500500*time.Microsecond {
+		t.Errorf("unexpected session-time %v", d)
+	}
+	if d := update.SessionEndTimeDuration(); d != time.Second {
+		t.Errorf("unexpected session-end-time %v", d)
+	}
+	if d := update.TimeOfDayDuration(); d != 14*time.Hour+30*time.Minute {
+		t.Errorf("unexpected time of day %v", d)
+	}
+
+	lap := Lap{LapTimeMs: 138123, Splits: []int32{40000, InvalidSectorTime, 50123}}
+	if d := lap.LapTime(); d != 2*time.Minute+18123*time.Millisecond {
+		t.Errorf("unexpected lap-time %v", d)
+	}
+	if splits := lap.SplitTimes(); !reflect.DeepEqual(splits, []time.Duration{40 * time.Second, 0, 50123 * time.Millisecond}) {
+		t.Errorf("unexpected splits %v", splits)
+	}
+
+	if d := (BroadCastEvent{TimeMs: 2500}).Time(); d != 2500*time.Millisecond {
+		t.Errorf("unexpected event time %v", d)
+	}
+}
@@ -0,0 +1,493 @@
+// Package relay multiplexes many clients of the ACC broadcasting interface onto a single connection to ACC.
+//
+// The Relay speaks the broadcasting protocol towards its own clients (e.g. the network.Client of this module or
+// the official C# tools) exactly as ACC does, such that these do not need to be aware of the Relay. ACC only sees a
+// single registration, which also reduces the load on ACC when many tools are used simultaneously.
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"net"
+	"sync"
+	"time"
+)
+
+// Relay holds a single connection to ACC and forwards everything that is received from ACC to all clients that
+// registered with the Relay. The datagrams are forwarded as received from ACC, only the connection id in the
+// entry-list and track-data is replaced by the connection id of each client.
+//
+// The track-data and entry-list are cached, thus requests for these from the clients are answered by the Relay
+// itself, without the clients that are already registered receiving them again. When ACC sends an update of a car
+// that is not in the entry-list (i.e. a car joined the session), the Relay requests the entry-list again (see
+// network.Client.GateOnEntryList) and the refreshed entry-list is pushed to all clients. The focus, HUD-page and
+// instant-replay commands of clients that registered with the CommandPassword are forwarded to ACC, other
+// commands are dropped.
+//
+// The realtime-update interval requested by the clients is ignored, all clients receive the updates at the
+// interval the Relay requested from ACC.
+type Relay struct {
+	Logger zerolog.Logger
+
+	// Client is used for the connection to ACC. It is created by Run if not set. Its callbacks are replaced
+	// by Run, but its Logger, Recorder, etc. can be set. The Recorder is chained by Run to receive the datagrams
+	// that are forwarded and is restored when Run returns.
+	Client *network.Client
+
+	// Backoff between attempts to reconnect to ACC, see network.Supervisor
+	Backoff network.Backoff
+
+	// ConnectionPassword needs to be send by the clients at registration, otherwise the registration is refused
+	ConnectionPassword string
+
+	// CommandPassword needs to be send by the clients at registration to be allowed to send commands, otherwise
+	// the clients are registered read-only. The commands are only forwarded if the Relay itself is not
+	// read-only towards ACC.
+	CommandPassword string
+
+	// ClientTimeout, if set, after which a client that did not send anything is removed. By default, clients are
+	// only removed when they unregister or when sending to them fails, as clients that only listen (like the
+	// network.Client) never send anything after registering.
+	ClientTimeout time.Duration
+
+	conn *net.UDPConn
+	done chan struct{}
+
+	mutex            sync.Mutex
+	clients          map[string]*downstream
+	nextConnectionId int32
+
+	// cached datagrams as received from ACC, nil if not received yet
+	trackData     []byte
+	entryList     []byte
+	entryListIds  network.EntryList
+	entryListCars map[uint16][]byte
+}
+
+// upstream receives the datagrams of the Client that are forwarded, see Relay.Run
+type upstream struct {
+	relay    *Relay
+	recorder network.Recorder // Recorder of the Client that is chained
+}
+
+// downstream is a client registered with the Relay
+type downstream struct {
+	addr         *net.UDPAddr
+	name         string
+	connectionId int32
+	writable     bool
+	lastSeen     time.Time // time the client send its most recent message
+}
+
+// Listen starts listening for clients on the UDP address, e.g. "0.0.0.0:9000"
+func (relay *Relay) Listen(address string) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	relay.conn, err = net.ListenUDP("udp", addr)
+	return err
+}
+
+// Addr returns the address the Relay is listening on
+func (relay *Relay) Addr() string {
+	return relay.conn.LocalAddr().String()
+}
+
+// Run connects to ACC, reconnecting whenever the connection breaks (see network.Supervisor), and serves the
+// clients until the context is cancelled. Listen needs to be called before Run. When Run returns, the Relay
+// stopped listening.
+func (relay *Relay) Run(ctx context.Context, cfg network.Config) error {
+	if relay.conn == nil {
+		return fmt.Errorf("relay is not listening")
+	}
+	if relay.Client == nil {
+		relay.Client = &network.Client{Logger: relay.Logger}
+	}
+
+	relay.mutex.Lock()
+	relay.clients = make(map[string]*downstream)
+	relay.entryListCars = make(map[uint16][]byte)
+	relay.mutex.Unlock()
+
+	// the datagrams are forwarded by the Recorder, thus without being unmarshaled and marshaled again
+	client := relay.Client
+	client.OnConnected = nil
+	client.OnDisconnected = relay.upstreamDisconnected
+	client.OnRealTimeUpdate = nil
+	client.OnRealTimeCarUpdate = nil
+	client.OnBroadCastEvent = nil
+	client.OnEntryList = nil
+	client.OnEntryListCar = nil
+	client.OnTrackData = nil
+	client.GateOnEntryList = true
+	recorder := client.Recorder
+	client.Recorder = &upstream{relay: relay, recorder: recorder}
+	defer func() { client.Recorder = recorder }()
+
+	relay.done = make(chan struct{})
+	var serving sync.WaitGroup
+	serving.Add(1)
+	go func() {
+		defer serving.Done()
+		relay.serve()
+	}()
+	if relay.ClientTimeout > 0 {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			relay.expire()
+		}()
+	}
+
+	supervisor := network.Supervisor{Client: client, Backoff: relay.Backoff}
+	err := supervisor.Run(ctx, cfg)
+
+	close(relay.done)
+	relay.conn.Close()
+	serving.Wait()
+	return err
+}
+
+// Clients returns the number of clients that are currently registered
+func (relay *Relay) Clients() int {
+	relay.mutex.Lock()
+	defer relay.mutex.Unlock()
+	return len(relay.clients)
+}
+
+func (relay *Relay) serve() {
+	var readArray [network.ReadBufferSize]byte
+	for {
+		n, addr, err := relay.conn.ReadFromUDP(readArray[:])
+		if err != nil {
+			select {
+			case <-relay.done:
+				return
+			default:
+				continue
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		relay.handle(addr, readArray[:n])
+	}
+}
+
+func (relay *Relay) handle(addr *net.UDPAddr, datagram []byte) {
+	msgType, readBuffer := datagram[0], bytes.NewBuffer(datagram[1:])
+	if msgType == network.RegisterCommandApplication {
+		relay.register(addr, readBuffer)
+		return
+	}
+
+	relay.mutex.Lock()
+	client, found := relay.clients[addr.String()]
+	if found {
+		client.lastSeen = time.Now()
+	}
+	relay.mutex.Unlock()
+	if !found {
+		relay.Logger.Warn().Msgf("Ignoring message %d from unregistered client %s", msgType, addr)
+		return
+	}
+
+	switch msgType {
+	case network.UnregisterCommandApplication:
+		relay.mutex.Lock()
+		delete(relay.clients, addr.String())
+		relay.mutex.Unlock()
+		relay.Logger.Info().Msgf("Client '%s' (%s) unregistered", client.name, addr)
+
+	case network.RequestEntryList:
+		relay.sendEntryList(client)
+
+	case network.RequestTrackData:
+		relay.sendTrackData(client)
+
+	case network.ChangeFocus:
+		connectionId, carId, cameraSet, camera, ok := network.UnmarshalFocusReq(readBuffer)
+		if !relay.permitted(client, connectionId, ok, "focus-req") {
+			return
+		}
+		if carId < 0 {
+			relay.forwarded(client, "focus-req", relay.Client.RequestCamera(cameraSet, camera))
+		} else {
+			relay.forwarded(client, "focus-req", relay.Client.RequestFocus(uint16(carId), cameraSet, camera))
+		}
+
+	case network.ChangeHUDPage:
+		connectionId, page, ok := network.UnmarshalHUDPageReq(readBuffer)
+		if relay.permitted(client, connectionId, ok, "hudpage-req") {
+			relay.forwarded(client, "hudpage-req", relay.Client.RequestHUDPage(page))
+		}
+
+	case network.InstantReplayRequest:
+		connectionId, startSessionTimeMs, durationMs, carId, cameraSet, camera, ok := network.UnmarshalInstantReplayReq(readBuffer)
+		if relay.permitted(client, connectionId, ok, "instantreplay-req") {
+			err := relay.Client.RequestInstantReplay(startSessionTimeMs, durationMs, carId, cameraSet, camera)
+			relay.forwarded(client, "instantreplay-req", err)
+		}
+
+	default:
+		relay.Logger.Warn().Msgf("Dropping unsupported message %d from client '%s' (%s)", msgType, client.name, addr)
+	}
+}
+
+func (relay *Relay) register(addr *net.UDPAddr, readBuffer *bytes.Buffer) {
+	_, name, connectionPassword, _, commandPassword, ok := network.UnmarshalRegistrationReq(readBuffer)
+	if !ok {
+		relay.Logger.Warn().Msgf("Ignoring invalid registration from %s", addr)
+		return
+	}
+
+	var writeBuffer bytes.Buffer
+	if connectionPassword != relay.ConnectionPassword {
+		relay.Logger.Warn().Msgf("Refusing registration of client '%s' (%s): wrong password", name, addr)
+		network.MarshalConnectionResp(&writeBuffer, -1, 0, 0, "Wrong password")
+		if _, err := relay.conn.WriteToUDP(writeBuffer.Bytes(), addr); err != nil {
+			relay.Logger.Warn().Msgf("Could not refuse registration of client '%s' (%s): %v", name, addr, err)
+		}
+		return
+	}
+
+	relay.mutex.Lock()
+	client := &downstream{
+		addr:         addr,
+		name:         name,
+		connectionId: relay.nextConnectionId,
+		writable:     commandPassword == relay.CommandPassword,
+		lastSeen:     time.Now(),
+	}
+	relay.nextConnectionId++
+	relay.clients[addr.String()] = client
+	relay.mutex.Unlock()
+
+	relay.Logger.Info().Msgf("Client '%s' (%s) registered: id:%d, writable:%t", name, addr, client.connectionId, client.writable)
+	var writable int8
+	if client.writable {
+		writable = 1
+	}
+	network.MarshalConnectionResp(&writeBuffer, client.connectionId, 1, writable, "")
+	relay.send(client, writeBuffer.Bytes())
+}
+
+// forwarded logs the error of forwarding the request of the client to ACC, if any
+func (relay *Relay) forwarded(client *downstream, reqName string, err error) {
+	if err != nil {
+		relay.Logger.Warn().Msgf("Could not forward %s of client '%s' (%s): %v", reqName, client.name, client.addr, err)
+	}
+}
+
+// permitted returns true if the command of the client can be forwarded to ACC
+func (relay *Relay) permitted(client *downstream, connectionId int32, ok bool, reqName string) bool {
+	switch {
+	case !ok:
+		relay.Logger.Warn().Msgf("Dropping invalid %s from client '%s' (%s)", reqName, client.name, client.addr)
+	case connectionId != client.connectionId:
+		relay.Logger.Warn().Msgf("Dropping %s from client '%s' (%s): connection id %d instead of %d", reqName, client.name, client.addr, connectionId, client.connectionId)
+	case !client.writable:
+		relay.Logger.Warn().Msgf("Dropping %s from read-only client '%s' (%s)", reqName, client.name, client.addr)
+	default:
+		return true
+	}
+	return false
+}
+
+// sendEntryList sends the cached entry-list to the client, or requests it from ACC if not received yet
+func (relay *Relay) sendEntryList(client *downstream) {
+	relay.mutex.Lock()
+	entryList := relay.entryList
+	cars := make([][]byte, 0, len(relay.entryListIds))
+	for _, carId := range relay.entryListIds {
+		if car, found := relay.entryListCars[carId]; found {
+			cars = append(cars, car)
+		}
+	}
+	relay.mutex.Unlock()
+
+	if entryList == nil {
+		relay.forwarded(client, "entrylist-req", relay.Client.RequestEntryList())
+		return
+	}
+
+	relay.send(client, withConnectionId(entryList, client.connectionId))
+	for _, car := range cars {
+		relay.send(client, car)
+	}
+}
+
+// sendTrackData sends the cached track-data to the client, or requests it from ACC if not received yet
+func (relay *Relay) sendTrackData(client *downstream) {
+	relay.mutex.Lock()
+	trackData := relay.trackData
+	relay.mutex.Unlock()
+
+	if trackData == nil {
+		relay.forwarded(client, "trackdata-req", relay.Client.RequestTrackData())
+		return
+	}
+	relay.send(client, withConnectionId(trackData, client.connectionId))
+}
+
+func (relay *Relay) upstreamDisconnected() {
+	relay.mutex.Lock()
+	defer relay.mutex.Unlock()
+	relay.trackData = nil
+	relay.entryList = nil
+	relay.entryListIds = nil
+	relay.entryListCars = make(map[uint16][]byte)
+}
+
+// Record forwards the datagrams received from ACC to the clients of the Relay
+func (upstream *upstream) Record(direction network.Direction, datagram []byte) {
+	if upstream.recorder != nil {
+		upstream.recorder.Record(direction, datagram)
+	}
+	if direction != network.Inbound || len(datagram) == 0 {
+		return
+	}
+
+	relay := upstream.relay
+	switch datagram[0] {
+	case network.RealtimeUpdateMsgType, network.RealtimeCarUpdateMsgType, network.BroadcastingEventMsgType:
+		relay.broadcast(datagram)
+	case network.EntryListMsgType:
+		relay.upstreamEntryList(datagram)
+	case network.EntryListCarMsgType:
+		relay.upstreamEntryListCar(datagram)
+	case network.TrackDataMsgType:
+		relay.upstreamTrackData(datagram)
+	}
+}
+
+func (relay *Relay) upstreamEntryList(datagram []byte) {
+	_, entryList, ok := network.UnmarshalEntryListRep(bytes.NewBuffer(datagram[1:]))
+	if !ok {
+		relay.Logger.Warn().Msg("Not forwarding invalid entry-list")
+		return
+	}
+
+	relay.mutex.Lock()
+	relay.entryList = append([]byte(nil), datagram...)
+	relay.entryListIds = entryList
+	entryListCars := make(map[uint16][]byte, len(entryList))
+	for _, carId := range entryList {
+		if car, found := relay.entryListCars[carId]; found {
+			entryListCars[carId] = car
+		}
+	}
+	relay.entryListCars = entryListCars
+	clients := relay.clientList()
+	relay.mutex.Unlock()
+
+	// the entry-list carries the connection id, thus differs for each client
+	for _, client := range clients {
+		relay.send(client, withConnectionId(datagram, client.connectionId))
+	}
+}
+
+func (relay *Relay) upstreamEntryListCar(datagram []byte) {
+	car, ok := network.UnmarshalEntryListCarResp(bytes.NewBuffer(datagram[1:]))
+	if !ok {
+		relay.Logger.Warn().Msg("Not forwarding invalid entry-list car")
+		return
+	}
+
+	relay.mutex.Lock()
+	relay.entryListCars[car.Id] = append([]byte(nil), datagram...)
+	relay.mutex.Unlock()
+	relay.broadcast(datagram)
+}
+
+func (relay *Relay) upstreamTrackData(datagram []byte) {
+	if len(datagram) < 5 {
+		relay.Logger.Warn().Msg("Not forwarding invalid track-data")
+		return
+	}
+
+	relay.mutex.Lock()
+	relay.trackData = append([]byte(nil), datagram...)
+	clients := relay.clientList()
+	relay.mutex.Unlock()
+
+	// the track-data carries the connection id, thus differs for each client
+	for _, client := range clients {
+		relay.send(client, withConnectionId(datagram, client.connectionId))
+	}
+}
+
+// withConnectionId returns a copy of the entry-list or track-data datagram with the connection id replaced
+func withConnectionId(datagram []byte, connectionId int32) []byte {
+	datagram = append([]byte(nil), datagram...)
+	binary.LittleEndian.PutUint32(datagram[1:5], uint32(connectionId))
+	return datagram
+}
+
+// broadcast sends the datagram to all registered clients
+func (relay *Relay) broadcast(datagram []byte) {
+	relay.mutex.Lock()
+	clients := relay.clientList()
+	relay.mutex.Unlock()
+
+	for _, client := range clients {
+		relay.send(client, datagram)
+	}
+}
+
+// send sends the datagram to the client, removing the client if this fails
+func (relay *Relay) send(client *downstream, datagram []byte) {
+	_, err := relay.conn.WriteToUDP(datagram, client.addr)
+	if err == nil {
+		return
+	}
+
+	relay.mutex.Lock()
+	key := client.addr.String()
+	removed := relay.clients[key] == client
+	if removed {
+		delete(relay.clients, key)
+	}
+	relay.mutex.Unlock()
+	if removed {
+		relay.Logger.Warn().Msgf("Client '%s' (%s) removed: could not send message %d: %v", client.name, client.addr, datagram[0], err)
+	}
+}
+
+// expire removes the clients that did not send anything during the ClientTimeout, until the Relay stops
+func (relay *Relay) expire() {
+	timeout := relay.ClientTimeout
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-relay.done:
+			return
+		case <-ticker.C:
+		}
+
+		relay.mutex.Lock()
+		for key, client := range relay.clients {
+			if time.Since(client.lastSeen) > timeout {
+				delete(relay.clients, key)
+				relay.Logger.Info().Msgf("Client '%s' (%s) removed: nothing received for %v", client.name, client.addr, timeout)
+			}
+		}
+		relay.mutex.Unlock()
+	}
+}
+
+// clientList returns the registered clients. The mutex needs to be locked.
+func (relay *Relay) clientList() []*downstream {
+	clients := make([]*downstream, 0, len(relay.clients))
+	for _, client := range relay.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
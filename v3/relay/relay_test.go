@@ -0,0 +1,395 @@
+package relay_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network/acctest"
+	"github.com/toonknapen/accbroadcastingsdk/v3/relay"
+	"net"
+	"testing"
+	"time"
+)
+
+const testTimeout = 2 * time.Second
+
+// downstream is a client of the relay collecting what it receives
+type downstream struct {
+	client    network.Client
+	connected chan int32
+	cars      chan network.EntryListCar
+	trackData chan network.TrackData
+	updates   chan network.RealTimeUpdate
+	done      chan error
+	cancel    context.CancelFunc
+}
+
+func connect(t *testing.T, addr string, commandPassword string) *downstream {
+	d := &downstream{
+		connected: make(chan int32, 1),
+		cars:      make(chan network.EntryListCar, 10),
+		trackData: make(chan network.TrackData, 10),
+		updates:   make(chan network.RealTimeUpdate, 1),
+		done:      make(chan error, 1),
+	}
+	d.client.OnConnected = func(connectionId int32) {
+		d.client.RequestEntryList()
+		d.client.RequestTrackData()
+		d.connected <- connectionId
+	}
+	d.client.OnEntryListCar = func(car network.EntryListCar) { d.cars <- car }
+	d.client.OnTrackData = func(trackData network.TrackData) { d.trackData <- trackData }
+	d.client.OnRealTimeUpdate = func(update network.RealTimeUpdate) {
+		select {
+		case d.updates <- update:
+		default:
+		}
+	}
+
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	go func() {
+		d.done <- d.client.Run(ctx, network.Config{
+			Address:            addr,
+			DisplayName:        "downstream",
+			ConnectionPassword: "relay",
+			CommandPassword:    commandPassword,
+			TimeoutMs:          500,
+		})
+	}()
+
+	select {
+	case <-d.connected:
+	case err := <-d.done:
+		t.Fatalf("could not connect to relay: %v", err)
+	case <-time.After(testTimeout):
+		t.Fatal("not connected to relay")
+	}
+	return d
+}
+
+// expectInitialData waits for the track-data and all cars of the entry-list
+func (d *downstream) expectInitialData(t *testing.T, cars int) {
+	select {
+	case trackData := <-d.trackData:
+		if trackData.Name != network.TrackNameSpa {
+			t.Errorf("unexpected track %q", trackData.Name)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("track-data not received")
+	}
+	for i := 0; i < cars; i++ {
+		select {
+		case <-d.cars:
+		case <-time.After(testTimeout):
+			t.Fatalf("received %d cars, expected %d", i, cars)
+		}
+	}
+	select {
+	case <-d.updates:
+	case <-time.After(testTimeout):
+		t.Fatal("no realtime-update received")
+	}
+}
+
+func countCommands(server *acctest.Server, msgType network.OutboundMessageTypes) (n int) {
+	for _, command := range server.Commands() {
+		if command.Type == msgType {
+			n++
+		}
+	}
+	return n
+}
+
+// register registers a client that does not use network.Client, to look at the datagrams as send by the relay
+func register(t *testing.T, addr string, commandPassword string) (conn net.Conn, connectionId int32, writable bool) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var writeBuffer bytes.Buffer
+	network.MarshalRegistrationReq(&writeBuffer, "raw", "relay", 1000, commandPassword)
+	conn.Write(writeBuffer.Bytes())
+	datagram := read(t, conn)
+	connectionId, success, isWritable, _, _ := network.UnmarshalConnectionResp(bytes.NewBuffer(datagram[1:]))
+	if success != 1 {
+		t.Fatal("raw client not registered")
+	}
+	return conn, connectionId, isWritable != 0
+}
+
+// read returns the next datagram received by the raw client
+func read(t *testing.T, conn net.Conn) []byte {
+	var readArray [network.ReadBufferSize]byte
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	n, err := conn.Read(readArray[:])
+	if err != nil {
+		t.Fatalf("nothing received from the relay: %v", err)
+	}
+	return append([]byte(nil), readArray[:n]...)
+}
+
+// readType returns the next datagram of the given message type received by the raw client
+func readType(t *testing.T, conn net.Conn, msgType network.InboundMessageTypes) []byte {
+	for {
+		if datagram := read(t, conn); datagram[0] == msgType {
+			return datagram
+		}
+	}
+}
+
+// startRelay starts a relay connected to the fake ACC, the returned function stops it
+func startRelay(t *testing.T, server *acctest.Server, r *relay.Relay) (stop func()) {
+	if err := r.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- r.Run(ctx, network.Config{
+			Address:                  server.Addr(),
+			DisplayName:              "relay",
+			ConnectionPassword:       server.ConnectionPassword,
+			RealtimeUpdateIntervalMs: 20,
+			TimeoutMs:                500,
+		})
+	}()
+	return func() {
+		cancel()
+		if err := <-stopped; !errors.Is(err, context.Canceled) {
+			t.Errorf("relay stopped with %v", err)
+		}
+	}
+}
+
+func TestRelay(t *testing.T) {
+	server := &acctest.Server{
+		ConnectionPassword: "asd",
+		CommandPassword:    "cmd",
+		EntryList:          []network.EntryListCar{{Id: 0, RaceNumber: 7}, {Id: 1, RaceNumber: 12}},
+		TrackData:          network.TrackData{Name: network.TrackNameSpa, Id: network.TrackIdSpa},
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	defer server.Close()
+
+	r := relay.Relay{ConnectionPassword: "relay", CommandPassword: "relaycmd"}
+	if err := r.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- r.Run(ctx, network.Config{
+			Address:                  server.Addr(),
+			DisplayName:              "relay",
+			ConnectionPassword:       "asd",
+			CommandPassword:          "cmd",
+			RealtimeUpdateIntervalMs: 20,
+			TimeoutMs:                500,
+		})
+	}()
+
+	writer := connect(t, r.Addr(), "relaycmd")
+	writer.expectInitialData(t, 2)
+	if writer.client.IsReadOnly() {
+		t.Error("client with command-password is read-only")
+	}
+
+	// a newcomer is served from the cache
+	entryListRequests := countCommands(server, network.RequestEntryList)
+	trackDataRequests := countCommands(server, network.RequestTrackData)
+	reader := connect(t, r.Addr(), "")
+	reader.expectInitialData(t, 2)
+	if !reader.client.IsReadOnly() {
+		t.Error("client without command-password is writable")
+	}
+	if countCommands(server, network.RequestEntryList) != entryListRequests || countCommands(server, network.RequestTrackData) != trackDataRequests {
+		t.Error("entry-list or track-data requested from ACC again")
+	}
+	if server.ClientCount() != 1 || r.Clients() != 2 {
+		t.Errorf("%d registrations at ACC, %d at the relay", server.ClientCount(), r.Clients())
+	}
+
+	// commands of the writable client are forwarded
+	if err := writer.client.RequestFocus(1, "", ""); err != nil {
+		t.Fatalf("focus request failed: %v", err)
+	}
+	command, ok := server.WaitForCommand(network.ChangeFocus, 1, testTimeout)
+	if !ok {
+		t.Fatal("focus request not forwarded")
+	}
+	connectionId, carId, _, _, _ := network.UnmarshalFocusReq(bytes.NewBuffer(command.Datagram[1:]))
+	if connectionId != 0 || carId != 1 {
+		t.Errorf("forwarded focus on car %d with connection %d", carId, connectionId)
+	}
+
+	// commands of a read-only client are dropped by the relay
+	conn, rawConnectionId, writable := register(t, r.Addr(), "wrong")
+	defer conn.Close()
+	if writable {
+		t.Fatal("raw client without command-password is writable")
+	}
+	var writeBuffer bytes.Buffer
+	network.MarshalHUDPageReq(&writeBuffer, rawConnectionId, network.HUDPageBroadcasting)
+	conn.Write(writeBuffer.Bytes())
+	if _, ok := server.WaitForCommand(network.ChangeHUDPage, 1, 200*time.Millisecond); ok {
+		t.Error("command of read-only client forwarded")
+	}
+
+	// unregistering is handled by the relay
+	reader.cancel()
+	<-reader.done
+	start := time.Now()
+	for r.Clients() != 2 {
+		if time.Since(start) > testTimeout {
+			t.Fatalf("%d clients registered after unregistering", r.Clients())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	writer.cancel()
+	<-writer.done
+	cancel()
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("relay stopped with %v", err)
+	}
+}
+
+func TestRelayWrongPassword(t *testing.T) {
+	var r relay.Relay
+	r.ConnectionPassword = "relay"
+	if err := r.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, network.Config{Address: "127.0.0.1:1", TimeoutMs: 100})
+
+	var client network.Client
+	err := client.Run(context.Background(), network.Config{Address: r.Addr(), ConnectionPassword: "wrong", TimeoutMs: 500})
+	if !errors.Is(err, network.ErrRegistrationRejected) {
+		t.Errorf("expected ErrRegistrationRejected, got %v", err)
+	}
+}
+
+func TestRelayForwardsDatagrams(t *testing.T) {
+	update := network.RealTimeCarUpdate{
+		Id:       1,
+		DriverId: 1,
+		LastLap:  network.Lap{LapTimeMs: 130000, CarId: 1, DriverId: 1, Splits: []int32{45000, network.InvalidSectorTime, 43000}, IsInvalid: 1},
+	}
+	server := &acctest.Server{
+		ConnectionPassword: "asd",
+		TrackData:          network.TrackData{Name: network.TrackNameSpa, Id: network.TrackIdSpa, Meters: 7004},
+		Frames:             []acctest.Frame{{CarUpdates: []network.RealTimeCarUpdate{update}}},
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	defer server.Close()
+	r := relay.Relay{ConnectionPassword: "relay"}
+	defer startRelay(t, server, &r)()
+
+	conn, connectionId, _ := register(t, r.Addr(), "")
+	defer conn.Close()
+
+	// the car update is forwarded as received from ACC
+	var expected bytes.Buffer
+	network.MarshalCarUpdateResp(&expected, update)
+	if datagram := readType(t, conn, network.RealtimeCarUpdateMsgType); !bytes.Equal(datagram, expected.Bytes()) {
+		t.Errorf("car update modified by the relay:\n%v\n%v", datagram, expected.Bytes())
+	}
+
+	// only the connection id of the track-data is replaced
+	var writeBuffer bytes.Buffer
+	network.MarshalTrackDataReq(&writeBuffer, connectionId)
+	conn.Write(writeBuffer.Bytes())
+	expected.Reset()
+	network.MarshalTrackDataResp(&expected, connectionId, server.TrackData)
+	if datagram := readType(t, conn, network.TrackDataMsgType); !bytes.Equal(datagram, expected.Bytes()) {
+		t.Errorf("unexpected track-data:\n%v\n%v", datagram, expected.Bytes())
+	}
+}
+
+func TestRelayCarJoining(t *testing.T) {
+	cars := []network.EntryListCar{{Id: 0, RaceNumber: 7}, {Id: 1, RaceNumber: 12}}
+	server := &acctest.Server{
+		ConnectionPassword: "asd",
+		EntryList:          cars,
+		TrackData:          network.TrackData{Name: network.TrackNameSpa, Id: network.TrackIdSpa},
+		Frames:             []acctest.Frame{{CarUpdates: []network.RealTimeCarUpdate{{Id: 0}, {Id: 1}, {Id: 2}}}},
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	defer server.Close()
+	r := relay.Relay{ConnectionPassword: "relay", Client: &network.Client{EntryListRequestInterval: 50 * time.Millisecond}}
+	defer startRelay(t, server, &r)()
+
+	d := connect(t, r.Addr(), "")
+	defer func() {
+		d.cancel()
+		<-d.done
+	}()
+	d.expectInitialData(t, len(cars))
+
+	// the car joins once it is in the entry-list of ACC
+	server.SetEntryList(append(cars, network.EntryListCar{Id: 2, RaceNumber: 99}))
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case car := <-d.cars:
+			if car.Id == 2 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("joining car not pushed to the client")
+		}
+	}
+}
+
+func TestRelayClientTimeout(t *testing.T) {
+	server := &acctest.Server{ConnectionPassword: "asd"}
+	if err := server.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	defer server.Close()
+	r := relay.Relay{ConnectionPassword: "relay", ClientTimeout: 200 * time.Millisecond}
+	defer startRelay(t, server, &r)()
+
+	// the client keeps sending requests, the other one disappears without unregistering
+	active, connectionId, _ := register(t, r.Addr(), "")
+	defer active.Close()
+	gone, _, _ := register(t, r.Addr(), "")
+	gone.Close()
+
+	var writeBuffer bytes.Buffer
+	network.MarshalTrackDataReq(&writeBuffer, connectionId)
+	for start := time.Now(); time.Since(start) < 600*time.Millisecond; time.Sleep(20 * time.Millisecond) {
+		active.Write(writeBuffer.Bytes())
+	}
+	if r.Clients() != 1 {
+		t.Errorf("%d clients registered instead of only the active one", r.Clients())
+	}
+}
+
+func TestRelayKeepsListeningClients(t *testing.T) {
+	server := &acctest.Server{ConnectionPassword: "asd"}
+	if err := server.Start(); err != nil {
+		t.Fatalf("could not start fake ACC: %v", err)
+	}
+	defer server.Close()
+	r := relay.Relay{ConnectionPassword: "relay"}
+	defer startRelay(t, server, &r)()
+
+	// without ClientTimeout, a client that only listens remains registered
+	conn, _, _ := register(t, r.Addr(), "")
+	defer conn.Close()
+	time.Sleep(300 * time.Millisecond)
+	if r.Clients() != 1 {
+		t.Errorf("listening client removed, %d clients registered", r.Clients())
+	}
+}
@@ -0,0 +1,123 @@
+// Package state aggregates the messages received by a network.Client into a consistent view of the session
+// such that every application does not need to re-implement the same bookkeeping.
+//
+// The types in this package are fed by a network.Client, either by calling Attach before running the
+// Client or by calling their Handle<message> methods from the callbacks of the Client directly.
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+)
+
+// ConnectedHandler and the other handlers below are implemented by the types in this package, each type
+// only implements the handlers for the messages it needs.
+type ConnectedHandler interface {
+	HandleConnected(connectionId int32)
+}
+
+type DisconnectedHandler interface {
+	HandleDisconnected()
+}
+
+type RealTimeUpdateHandler interface {
+	HandleRealTimeUpdate(network.RealTimeUpdate)
+}
+
+type RealTimeCarUpdateHandler interface {
+	HandleRealTimeCarUpdate(network.RealTimeCarUpdate)
+}
+
+type EntryListHandler interface {
+	HandleEntryList(network.EntryList)
+}
+
+type EntryListCarHandler interface {
+	HandleEntryListCar(network.EntryListCar)
+}
+
+type TrackDataHandler interface {
+	HandleTrackData(network.TrackData)
+}
+
+type BroadCastEventHandler interface {
+	HandleBroadCastEvent(network.BroadCastEvent)
+}
+
+// Attach chains the handlers implemented by handler to the callbacks of the client.
+//
+// The handler is called before the callback that was already set, such that the callback sees the
+// updated state. Attach needs to be called before the client is run.
+func Attach(client *network.Client, handler interface{}) {
+	if h, ok := handler.(ConnectedHandler); ok {
+		previous := client.OnConnected
+		client.OnConnected = func(connectionId int32) {
+			h.HandleConnected(connectionId)
+			if previous != nil {
+				previous(connectionId)
+			}
+		}
+	}
+	if h, ok := handler.(DisconnectedHandler); ok {
+		previous := client.OnDisconnected
+		client.OnDisconnected = func() {
+			h.HandleDisconnected()
+			if previous != nil {
+				previous()
+			}
+		}
+	}
+	if h, ok := handler.(RealTimeUpdateHandler); ok {
+		previous := client.OnRealTimeUpdate
+		client.OnRealTimeUpdate = func(update network.RealTimeUpdate) {
+			h.HandleRealTimeUpdate(update)
+			if previous != nil {
+				previous(update)
+			}
+		}
+	}
+	if h, ok := handler.(RealTimeCarUpdateHandler); ok {
+		previous := client.OnRealTimeCarUpdate
+		client.OnRealTimeCarUpdate = func(update network.RealTimeCarUpdate) {
+			h.HandleRealTimeCarUpdate(update)
+			if previous != nil {
+				previous(update)
+			}
+		}
+	}
+	if h, ok := handler.(EntryListHandler); ok {
+		previous := client.OnEntryList
+		client.OnEntryList = func(entryList network.EntryList) {
+			h.HandleEntryList(entryList)
+			if previous != nil {
+				previous(entryList)
+			}
+		}
+	}
+	if h, ok := handler.(EntryListCarHandler); ok {
+		previous := client.OnEntryListCar
+		client.OnEntryListCar = func(car network.EntryListCar) {
+			h.HandleEntryListCar(car)
+			if previous != nil {
+				previous(car)
+			}
+		}
+	}
+	if h, ok := handler.(TrackDataHandler); ok {
+		previous := client.OnTrackData
+		client.OnTrackData = func(trackData network.TrackData) {
+			h.HandleTrackData(trackData)
+			if previous != nil {
+				previous(trackData)
+			}
+		}
+	}
+	if h, ok := handler.(BroadCastEventHandler); ok {
+		previous := client.OnBroadCastEvent
+		client.OnBroadCastEvent = func(event network.BroadCastEvent) {
+			h.HandleBroadCastEvent(event)
+			if previous != nil {
+				previous(event)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"sync"
+	"time"
+)
+
+// clockTolerance is the amount a new estimate of the start of the session may be later than the current
+// estimate before the estimate is replaced, e.g. because the session was paused
+const clockTolerance = time.Second
+
+// Clock relates the different time references used by ACC to each other and to the wall-clock.
+//
+// The session-time of a RealTimeUpdate is relative to the start of the session, whereas the TimeMs of a
+// BroadCastEvent is relative to the moment the connection was established. The Clock keeps track of the moment
+// of connecting and estimates the wall-clock time at which the session started, to convert between these.
+//
+// As the RealTimeUpdate's are delayed by the network, the earliest estimate of the start of the session is kept.
+// The estimate is reset when a new session starts or when the session-time did not advance in line with the
+// wall-clock (e.g. the session was paused).
+//
+// All methods are safe to be called concurrently. The zero value is ready to use.
+type Clock struct {
+	mutex        sync.Mutex
+	now          func() time.Time // replaced in the tests
+	connected    time.Time
+	sessionIndex uint16
+	sessionStart time.Time
+}
+
+// NewClock returns a Clock that is attached to the client (see Attach)
+func NewClock(client *network.Client) *Clock {
+	clock := &Clock{}
+	Attach(client, clock)
+	return clock
+}
+
+func (clock *Clock) timeNow() time.Time {
+	if clock.now != nil {
+		return clock.now()
+	}
+	return time.Now()
+}
+
+// HandleConnected marks the moment the connection was established
+func (clock *Clock) HandleConnected(connectionId int32) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.connected = clock.timeNow()
+}
+
+// HandleRealTimeUpdate updates the estimate of the start of the session
+func (clock *Clock) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	estimate := clock.timeNow().Add(-update.SessionTimeDuration())
+	if clock.sessionStart.IsZero() || update.SessionIndex != clock.sessionIndex ||
+		estimate.Before(clock.sessionStart) || estimate.Sub(clock.sessionStart) > clockTolerance {
+		clock.sessionStart = estimate
+	}
+	clock.sessionIndex = update.SessionIndex
+}
+
+// Connected returns the wall-clock time at which the connection was established,
+// ok is false if not connected yet
+func (clock *Clock) Connected() (connected time.Time, ok bool) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.connected, !clock.connected.IsZero()
+}
+
+// SessionStart returns the estimated wall-clock time at which the session started,
+// ok is false if no RealTimeUpdate is received yet
+func (clock *Clock) SessionStart() (sessionStart time.Time, ok bool) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.sessionStart, !clock.sessionStart.IsZero()
+}
+
+// WallClock returns the estimated wall-clock time corresponding to the session-time
+func (clock *Clock) WallClock(sessionTime time.Duration) (wallClock time.Time, ok bool) {
+	sessionStart, ok := clock.SessionStart()
+	if !ok {
+		return wallClock, false
+	}
+	return sessionStart.Add(sessionTime), true
+}
+
+// EventWallClock returns the wall-clock time of the event
+func (clock *Clock) EventWallClock(event network.BroadCastEvent) (wallClock time.Time, ok bool) {
+	connected, ok := clock.Connected()
+	if !ok {
+		return wallClock, false
+	}
+	return connected.Add(event.Time()), true
+}
+
+// EventSessionTime returns the session-time of the event.
+// Ok is false if not connected yet or if no RealTimeUpdate is received yet.
+func (clock *Clock) EventSessionTime(event network.BroadCastEvent) (sessionTime time.Duration, ok bool) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	if clock.connected.IsZero() || clock.sessionStart.IsZero() {
+		return 0, false
+	}
+	return clock.connected.Add(event.Time()).Sub(clock.sessionStart), true
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Date(2020, 11, 1, 14, 0, 0, 0, time.UTC)
+	clock := Clock{now: func() time.Time { return now }}
+
+	if _, ok := clock.EventSessionTime(network.BroadCastEvent{TimeMs: 1000}); ok {
+		t.Error("event converted before connecting")
+	}
+
+	// connecting 10 minutes into the session
+	clock.HandleConnected(1)
+	now = now.Add(100 * time.Millisecond)
+	clock.HandleRealTimeUpdate(network.RealTimeUpdate{SessionTime: 600000})
+	// a delayed update does not affect the estimate
+	now = now.Add(1100 * time.Millisecond)
+	clock.HandleRealTimeUpdate(network.RealTimeUpdate{SessionTime: 600900})
+
+	sessionStart, ok := clock.SessionStart()
+	expectedStart := time.Date(2020, 11, 1, 13, 50, 0, 100000000, time.UTC)
+	if !ok || !sessionStart.Equal(expectedStart) {
+		t.Errorf("unexpected session start %v", sessionStart)
+	}
+	if sessionTime, ok := clock.EventSessionTime(network.BroadCastEvent{TimeMs: 5000}); !ok || sessionTime != 605*time.Second-100*time.Millisecond {
+		t.Errorf("unexpected session-time of event %v", sessionTime)
+	}
+	if wallClock, ok := clock.EventWallClock(network.BroadCastEvent{TimeMs: 5000}); !ok || !wallClock.Equal(time.Date(2020, 11, 1, 14, 0, 5, 0, time.UTC)) {
+		t.Errorf("unexpected wall-clock of event %v", wallClock)
+	}
+	if wallClock, ok := clock.WallClock(time.Hour); !ok || !wallClock.Equal(expectedStart.Add(time.Hour)) {
+		t.Errorf("unexpected wall-clock of session-time %v", wallClock)
+	}
+
+	// after a pause, the estimate is replaced
+	now = now.Add(time.Minute)
+	clock.HandleRealTimeUpdate(network.RealTimeUpdate{SessionTime: 601000})
+	if sessionStart, _ := clock.SessionStart(); !sessionStart.Equal(now.Add(-601 * time.Second)) {
+		t.Errorf("estimate not replaced after pause: %v", sessionStart)
+	}
+}
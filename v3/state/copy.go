@@ -0,0 +1,52 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+)
+
+// The functions below make deep copies such that a copy does not share any slices or maps with the original
+
+func copyTrackData(trackData network.TrackData) network.TrackData {
+	if trackData.CameraSets != nil {
+		cameraSets := make(map[string][]string, len(trackData.CameraSets))
+		for name, cameras := range trackData.CameraSets {
+			cameraSets[name] = append([]string(nil), cameras...)
+		}
+		trackData.CameraSets = cameraSets
+	}
+	trackData.HUDPages = append([]string(nil), trackData.HUDPages...)
+	return trackData
+}
+
+func copyLap(lap network.Lap) network.Lap {
+	lap.Splits = append([]int32(nil), lap.Splits...)
+	return lap
+}
+
+func copyRealTimeUpdate(update network.RealTimeUpdate) network.RealTimeUpdate {
+	update.BestSessionLap = copyLap(update.BestSessionLap)
+	return update
+}
+
+func copyRealTimeCarUpdate(update network.RealTimeCarUpdate) network.RealTimeCarUpdate {
+	update.BestSessionLap = copyLap(update.BestSessionLap)
+	update.LastLap = copyLap(update.LastLap)
+	update.CurrentLap = copyLap(update.CurrentLap)
+	return update
+}
+
+func copyEntryListCar(car network.EntryListCar) network.EntryListCar {
+	car.Drivers = append([]network.Driver(nil), car.Drivers...)
+	return car
+}
+
+func copyCar(car Car) Car {
+	car.Entry = copyEntryListCar(car.Entry)
+	car.Update = copyRealTimeCarUpdate(car.Update)
+	return car
+}
+
+func copyStateLap(lap Lap) Lap {
+	lap.Splits = append([]int32(nil), lap.Splits...)
+	return lap
+}
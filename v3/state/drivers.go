@@ -0,0 +1,260 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DriverTime is the time and number of laps driven by a driver of a car in the current session
+type DriverTime struct {
+	CarId     uint16
+	DriverId  uint16 // index in EntryListCar.Drivers
+	Driver    network.Driver
+	DriveTime time.Duration
+	Laps      uint16
+	Stints    int // number of times the driver took over the car (including the start)
+}
+
+// DriverChange is the moment another driver takes over the car
+type DriverChange struct {
+	CarId            uint16
+	SessionTimeMs    float32
+	PreviousDriverId uint16
+	DriverId         uint16
+	PreviousDriver   network.Driver
+	Driver           network.Driver
+}
+
+// Violation is a driver not respecting the MinDriveTime or MaxDriveTime of the DriverTracker
+type Violation struct {
+	DriverTime
+	TooShort bool // DriveTime is below MinDriveTime
+	TooLong  bool // DriveTime is above MaxDriveTime
+}
+
+// DriverTracker accumulates the time and laps driven by every driver, e.g. to enforce the minimum and maximum
+// driving times of endurance races.
+//
+// The time is only accumulated while the session is running (SessionPhaseSession and SessionPhaseSessionOver),
+// based on the session-time of the RealTimeUpdate's. Everything is cleared when a new session starts.
+// Car updates with a DriverId that is not below their DriverCount are ignored.
+//
+// All methods are safe to be called concurrently. The zero value is ready to use.
+type DriverTracker struct {
+	// MinDriveTime and MaxDriveTime each driver of a car needs to respect during the session, 0 means no limit
+	MinDriveTime time.Duration
+	MaxDriveTime time.Duration
+
+	// OnDriverChange is called whenever another driver takes over a car
+	OnDriverChange func(DriverChange)
+
+	// OnViolation is called once for a driver as soon as the MaxDriveTime is exceeded.
+	// Drivers below MinDriveTime are only known at the end of the session, see Violations.
+	OnViolation func(Violation)
+
+	mutex         sync.Mutex
+	sessionIndex  uint16
+	sessionTimeMs float32
+	running       bool
+	cars          map[uint16]*driverCar
+}
+
+type driverCar struct {
+	entry         network.EntryListCar
+	hasUpdate     bool
+	driverId      uint16
+	driverCount   uint8 // DriverCount of the most recent update of the car
+	laps          uint16
+	sessionTimeMs float32 // session-time of the most recent update of the car
+	drivers       map[uint16]*DriverTime
+	exceeded      map[uint16]bool // drivers for which OnViolation was called
+}
+
+// NewDriverTracker returns a DriverTracker that is attached to the client (see Attach)
+func NewDriverTracker(client *network.Client) *DriverTracker {
+	driverTracker := &DriverTracker{}
+	Attach(client, driverTracker)
+	return driverTracker
+}
+
+// HandleRealTimeUpdate keeps track of the session-time and clears all drive times when a new session starts
+func (driverTracker *DriverTracker) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	driverTracker.mutex.Lock()
+	defer driverTracker.mutex.Unlock()
+
+	driverTracker.sessionTimeMs = update.SessionTime
+	driverTracker.running = update.Phase == network.SessionPhaseSession || update.Phase == network.SessionPhaseSessionOver
+	if update.SessionIndex != driverTracker.sessionIndex {
+		driverTracker.sessionIndex = update.SessionIndex
+		for _, car := range driverTracker.cars {
+			car.hasUpdate = false
+			car.drivers = nil
+			car.exceeded = nil
+		}
+	}
+}
+
+// HandleEntryListCar stores the drivers of the car
+func (driverTracker *DriverTracker) HandleEntryListCar(entry network.EntryListCar) {
+	driverTracker.mutex.Lock()
+	defer driverTracker.mutex.Unlock()
+	driverTracker.car(entry.Id).entry = entry
+}
+
+// HandleRealTimeCarUpdate accumulates the drive time and laps of the current driver
+func (driverTracker *DriverTracker) HandleRealTimeCarUpdate(update network.RealTimeCarUpdate) {
+	if int(update.DriverId) >= int(update.DriverCount) {
+		return
+	}
+	change, violation := driverTracker.update(update)
+	if change != nil && driverTracker.OnDriverChange != nil {
+		driverTracker.OnDriverChange(*change)
+	}
+	if violation != nil && driverTracker.OnViolation != nil {
+		driverTracker.OnViolation(*violation)
+	}
+}
+
+func (driverTracker *DriverTracker) update(update network.RealTimeCarUpdate) (change *DriverChange, violation *Violation) {
+	driverTracker.mutex.Lock()
+	defer driverTracker.mutex.Unlock()
+
+	car := driverTracker.car(update.Id)
+	now := driverTracker.sessionTimeMs
+
+	if !car.hasUpdate {
+		car.driverTime(update.DriverId).Stints++
+	} else {
+		// the time since the previous update and the completed lap are accounted to the previous driver
+		previous := car.driverTime(car.driverId)
+		if driverTracker.running && now > car.sessionTimeMs {
+			previous.DriveTime += network.Milliseconds(now - car.sessionTimeMs)
+		}
+		if update.Laps > car.laps {
+			previous.Laps += update.Laps - car.laps
+		}
+
+		if update.DriverId != car.driverId {
+			car.driverTime(update.DriverId).Stints++
+			change = &DriverChange{
+				CarId:            update.Id,
+				SessionTimeMs:    now,
+				PreviousDriverId: car.driverId,
+				DriverId:         update.DriverId,
+				PreviousDriver:   previous.Driver,
+				Driver:           car.driverTime(update.DriverId).Driver,
+			}
+		}
+
+		if driverTracker.MaxDriveTime > 0 && previous.DriveTime > driverTracker.MaxDriveTime && !car.exceeded[previous.DriverId] {
+			if car.exceeded == nil {
+				car.exceeded = make(map[uint16]bool)
+			}
+			car.exceeded[previous.DriverId] = true
+			violation = &Violation{DriverTime: *previous, TooLong: true}
+		}
+	}
+
+	car.hasUpdate = true
+	car.driverId = update.DriverId
+	car.driverCount = update.DriverCount
+	car.laps = update.Laps
+	car.sessionTimeMs = now
+	return change, violation
+}
+
+// car returns the car with the given id, adding it if unknown. The mutex needs to be locked.
+func (driverTracker *DriverTracker) car(id uint16) *driverCar {
+	if driverTracker.cars == nil {
+		driverTracker.cars = make(map[uint16]*driverCar)
+	}
+	car, found := driverTracker.cars[id]
+	if !found {
+		car = &driverCar{entry: network.EntryListCar{Id: id}}
+		driverTracker.cars[id] = car
+	}
+	return car
+}
+
+// driverTime returns the accounting of the given driver, adding it if unknown
+func (car *driverCar) driverTime(driverId uint16) *DriverTime {
+	if car.drivers == nil {
+		car.drivers = make(map[uint16]*DriverTime)
+	}
+	driverTime, found := car.drivers[driverId]
+	if !found {
+		driverTime = &DriverTime{CarId: car.entry.Id, DriverId: driverId}
+		car.drivers[driverId] = driverTime
+	}
+	if int(driverId) < len(car.entry.Drivers) {
+		driverTime.Driver = car.entry.Drivers[driverId]
+	}
+	return driverTime
+}
+
+// DriverTimes returns the drive time of every driver of the car, in order of DriverId.
+// Drivers that did not drive yet are included as well, as per the DriverCount of the car or its entry-list.
+func (driverTracker *DriverTracker) DriverTimes(carId uint16) []DriverTime {
+	driverTracker.mutex.Lock()
+	defer driverTracker.mutex.Unlock()
+
+	car, found := driverTracker.cars[carId]
+	if !found {
+		return nil
+	}
+	return car.driverTimes()
+}
+
+func (car *driverCar) driverTimes() []DriverTime {
+	count := len(car.entry.Drivers)
+	if int(car.driverCount) > count {
+		count = int(car.driverCount)
+	}
+	for driverId := range car.drivers {
+		if int(driverId) >= count {
+			count = int(driverId) + 1
+		}
+	}
+	driverTimes := make([]DriverTime, count)
+	for i := range driverTimes {
+		if driverTime, found := car.drivers[uint16(i)]; found {
+			driverTimes[i] = *driverTime
+		} else {
+			driverTimes[i] = DriverTime{CarId: car.entry.Id, DriverId: uint16(i)}
+			if i < len(car.entry.Drivers) {
+				driverTimes[i].Driver = car.entry.Drivers[i]
+			}
+		}
+	}
+	return driverTimes
+}
+
+// Violations returns the drivers of all cars that are currently below MinDriveTime or above MaxDriveTime.
+// Note that being below MinDriveTime is only a violation once the session is over.
+func (driverTracker *DriverTracker) Violations() []Violation {
+	driverTracker.mutex.Lock()
+	defer driverTracker.mutex.Unlock()
+
+	var violations []Violation
+	for _, car := range driverTracker.cars {
+		for _, driverTime := range car.driverTimes() {
+			violation := Violation{
+				DriverTime: driverTime,
+				TooShort:   driverTracker.MinDriveTime > 0 && driverTime.DriveTime < driverTracker.MinDriveTime,
+				TooLong:    driverTracker.MaxDriveTime > 0 && driverTime.DriveTime > driverTracker.MaxDriveTime,
+			}
+			if violation.TooShort || violation.TooLong {
+				violations = append(violations, violation)
+			}
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].CarId != violations[j].CarId {
+			return violations[i].CarId < violations[j].CarId
+		}
+		return violations[i].DriverId < violations[j].DriverId
+	})
+	return violations
+}
@@ -0,0 +1,73 @@
+package state_test
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"testing"
+	"time"
+)
+
+func TestDriverTracker(t *testing.T) {
+	var changes []state.DriverChange
+	var violations []state.Violation
+	driverTracker := state.DriverTracker{
+		MinDriveTime:   20 * time.Minute,
+		MaxDriveTime:   40 * time.Minute,
+		OnDriverChange: func(change state.DriverChange) { changes = append(changes, change) },
+		OnViolation:    func(violation state.Violation) { violations = append(violations, violation) },
+	}
+	driverTracker.HandleEntryListCar(network.EntryListCar{Id: 4, Drivers: append(testDrivers, network.Driver{ShortName: "CDR"})})
+
+	update := func(phase byte, minutes float32, laps uint16, driverId uint16) {
+		driverTracker.HandleRealTimeUpdate(network.RealTimeUpdate{Phase: phase, SessionTime: minutes * 60000})
+		driverTracker.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 4, Laps: laps, DriverId: driverId, DriverCount: 3})
+	}
+
+	// time before the green flag is not accounted
+	update(network.SessionPhasePreSession, 0, 0, 0)
+	update(network.SessionPhasePreSession, 5, 0, 0)
+	update(network.SessionPhaseSession, 5, 0, 0)
+	update(network.SessionPhaseSession, 30, 10, 0)
+	update(network.SessionPhaseSession, 50, 18, 0) // above the maximum
+	update(network.SessionPhaseSession, 51, 18, 1)
+	update(network.SessionPhaseSession, 61, 22, 1)
+	update(network.SessionPhaseSession, 62, 22, 3) // not a driver of the car
+
+	if len(changes) != 1 || changes[0].PreviousDriver.ShortName != "ADR" || changes[0].Driver.ShortName != "BDR" {
+		t.Errorf("unexpected driver changes: %+v", changes)
+	}
+	if len(violations) != 1 || !violations[0].TooLong || violations[0].DriverId != 0 {
+		t.Errorf("unexpected violations: %+v", violations)
+	}
+
+	driverTimes := driverTracker.DriverTimes(4)
+	if len(driverTimes) != 3 {
+		t.Fatalf("unexpected driver times: %+v", driverTimes)
+	}
+	if driverTimes[0].DriveTime != 46*time.Minute || driverTimes[0].Laps != 18 || driverTimes[0].Stints != 1 {
+		t.Errorf("unexpected time of first driver: %+v", driverTimes[0])
+	}
+	if driverTimes[1].DriveTime != 10*time.Minute || driverTimes[1].Laps != 4 || driverTimes[1].Stints != 1 {
+		t.Errorf("unexpected time of second driver: %+v", driverTimes[1])
+	}
+	if driverTimes[2].DriveTime != 0 || driverTimes[2].Driver.ShortName != "CDR" {
+		t.Errorf("driver that did not drive yet not included: %+v", driverTimes[2])
+	}
+
+	all := driverTracker.Violations()
+	if len(all) != 3 || !all[0].TooLong || !all[1].TooShort || !all[2].TooShort {
+		t.Errorf("unexpected violations: %+v", all)
+	}
+}
+
+func TestDriverTrackerDriverCount(t *testing.T) {
+	var driverTracker state.DriverTracker
+	driverTracker.HandleRealTimeUpdate(network.RealTimeUpdate{Phase: network.SessionPhaseSession})
+	driverTracker.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 2, DriverId: 1, DriverCount: 3})
+
+	// the drivers are known from the update, even without entry-list
+	driverTimes := driverTracker.DriverTimes(2)
+	if len(driverTimes) != 3 || driverTimes[1].Stints != 1 || driverTimes[2].DriverId != 2 {
+		t.Errorf("unexpected driver times: %+v", driverTimes)
+	}
+}
@@ -0,0 +1,280 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"sync"
+)
+
+// Lap is a lap completed by a car
+type Lap struct {
+	CarId    uint16
+	Number   uint16 // 1 for the first lap completed in the session
+	DriverId uint16 // index in EntryListCar.Drivers
+	Driver   network.Driver
+
+	LapTimeMs int32
+	Splits    []int32 // a split is 0 if the sector was invalid
+	IsValid   bool
+	IsOutLap  bool
+	IsInLap   bool
+}
+
+// LapTracker records the laps completed by every car in the current session.
+//
+// A lap is detected when the Laps counter of a car increments or when a BroadCastEventTypeLapCompleted is received
+// for the car. As ACC might only update the LastLap in a later update, the completed lap remains pending until the
+// LastLap of the car changes, and only then the LastLap is recorded.
+// The recorded laps are cleared when a new session starts.
+//
+// All methods are safe to be called concurrently. The zero value is ready to use.
+type LapTracker struct {
+	// OnLapCompleted, if set, is called for every lap that is recorded
+	OnLapCompleted func(Lap)
+
+	mutex        sync.Mutex
+	sessionIndex uint16
+	cars         map[uint16]*lapCar
+}
+
+type lapCar struct {
+	entry        network.EntryListCar
+	laps         uint16      // Laps counter of the most recent update
+	lastLap      network.Lap // LastLap of the most recent update
+	hasUpdate    bool
+	lapCompleted bool // lap completed but its LastLap not recorded yet
+	history      []Lap
+}
+
+// NewLapTracker returns a LapTracker that is attached to the client (see Attach)
+func NewLapTracker(client *network.Client) *LapTracker {
+	lapTracker := &LapTracker{}
+	Attach(client, lapTracker)
+	return lapTracker
+}
+
+// HandleRealTimeUpdate clears all laps when a new session starts
+func (lapTracker *LapTracker) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	lapTracker.mutex.Lock()
+	defer lapTracker.mutex.Unlock()
+
+	if update.SessionIndex != lapTracker.sessionIndex {
+		lapTracker.sessionIndex = update.SessionIndex
+		for _, car := range lapTracker.cars {
+			car.history = nil
+			car.hasUpdate = false
+			car.lapCompleted = false
+		}
+	}
+}
+
+// HandleEntryListCar stores the drivers of the car
+func (lapTracker *LapTracker) HandleEntryListCar(entry network.EntryListCar) {
+	lapTracker.mutex.Lock()
+	defer lapTracker.mutex.Unlock()
+	lapTracker.car(entry.Id).entry = entry
+}
+
+// HandleBroadCastEvent marks the lap of the car as completed in case of a BroadCastEventTypeLapCompleted
+func (lapTracker *LapTracker) HandleBroadCastEvent(event network.BroadCastEvent) {
+	if event.Type != network.BroadCastEventTypeLapCompleted || event.CarId < 0 {
+		return
+	}
+	lapTracker.mutex.Lock()
+	defer lapTracker.mutex.Unlock()
+	lapTracker.car(uint16(event.CarId)).lapCompleted = true
+}
+
+// HandleRealTimeCarUpdate records the LastLap when the car completed a lap
+func (lapTracker *LapTracker) HandleRealTimeCarUpdate(update network.RealTimeCarUpdate) {
+	lap, completed := lapTracker.update(update)
+	if completed && lapTracker.OnLapCompleted != nil {
+		lapTracker.OnLapCompleted(lap)
+	}
+}
+
+func (lapTracker *LapTracker) update(update network.RealTimeCarUpdate) (lap Lap, completed bool) {
+	lapTracker.mutex.Lock()
+	defer lapTracker.mutex.Unlock()
+
+	car := lapTracker.car(update.Id)
+	if car.hasUpdate && update.Laps > car.laps {
+		car.lapCompleted = true
+	}
+	// the first update does not tell if the LastLap changed, it is only recorded if the event was received
+	lastLapChanged := update.Laps > 0
+	if car.hasUpdate {
+		lastLapChanged = !sameLap(car.lastLap, update.LastLap)
+	}
+	car.laps, car.lastLap, car.hasUpdate = update.Laps, copyLap(update.LastLap), true
+
+	if !car.lapCompleted || !lastLapChanged {
+		// wait for ACC to update the LastLap
+		return lap, false
+	}
+	car.lapCompleted = false
+	if update.LastLap.LapTimeMs <= 0 || car.lastLapRecorded(update.LastLap) {
+		return lap, false
+	}
+
+	// the counter does not increment in every type of session
+	number := update.Laps
+	if len(car.history) > 0 && number <= car.history[len(car.history)-1].Number {
+		number = car.history[len(car.history)-1].Number + 1
+	}
+
+	lap = Lap{
+		CarId:     update.Id,
+		Number:    number,
+		DriverId:  update.LastLap.DriverId,
+		LapTimeMs: update.LastLap.LapTimeMs,
+		Splits:    splits(update.LastLap),
+		IsValid:   update.LastLap.IsInvalid == 0,
+		IsOutLap:  update.LastLap.IsOutLap != 0,
+		IsInLap:   update.LastLap.IsInLap != 0,
+	}
+	if int(lap.DriverId) < len(car.entry.Drivers) {
+		lap.Driver = car.entry.Drivers[lap.DriverId]
+	}
+	car.history = append(car.history, lap)
+	return copyStateLap(lap), true
+}
+
+// lastLapRecorded returns true if the lap is equal to the most recently recorded lap
+func (car *lapCar) lastLapRecorded(lap network.Lap) bool {
+	if len(car.history) == 0 {
+		return false
+	}
+	last := car.history[len(car.history)-1]
+	if last.LapTimeMs != lap.LapTimeMs || len(last.Splits) != len(lap.Splits) {
+		return false
+	}
+	for i, split := range splits(lap) {
+		if last.Splits[i] != split {
+			return false
+		}
+	}
+	return true
+}
+
+// sameLap returns true if both laps are equal
+func sameLap(a, b network.Lap) bool {
+	if a.LapTimeMs != b.LapTimeMs || a.CarId != b.CarId || a.DriverId != b.DriverId || len(a.Splits) != len(b.Splits) ||
+		a.IsInvalid != b.IsInvalid || a.IsValidForBest != b.IsValidForBest || a.IsOutLap != b.IsOutLap || a.IsInLap != b.IsInLap {
+		return false
+	}
+	for i := range a.Splits {
+		if a.Splits[i] != b.Splits[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splits returns a copy of the splits of the lap, with the invalid splits set to 0
+func splits(lap network.Lap) []int32 {
+	splits := make([]int32, len(lap.Splits))
+	for i, split := range lap.Splits {
+		if split != network.InvalidSectorTime {
+			splits[i] = split
+		}
+	}
+	return splits
+}
+
+// car returns the car with the given id, adding it if unknown. The mutex needs to be locked.
+func (lapTracker *LapTracker) car(id uint16) *lapCar {
+	if lapTracker.cars == nil {
+		lapTracker.cars = make(map[uint16]*lapCar)
+	}
+	car, found := lapTracker.cars[id]
+	if !found {
+		car = &lapCar{}
+		lapTracker.cars[id] = car
+	}
+	return car
+}
+
+// Laps returns all laps completed by the car, in order of completion
+func (lapTracker *LapTracker) Laps(carId uint16) []Lap {
+	lapTracker.mutex.Lock()
+	defer lapTracker.mutex.Unlock()
+	return lapTracker.laps(carId, func(Lap) bool { return true })
+}
+
+// DriverLaps returns the laps completed by the given driver of the car, in order of completion
+func (lapTracker *LapTracker) DriverLaps(carId uint16, driverId uint16) []Lap {
+	lapTracker.mutex.Lock()
+	defer lapTracker.mutex.Unlock()
+	return lapTracker.laps(carId, func(lap Lap) bool { return lap.DriverId == driverId })
+}
+
+// laps returns a copy of the laps of the car that match the filter. The mutex needs to be locked.
+func (lapTracker *LapTracker) laps(carId uint16, filter func(Lap) bool) []Lap {
+	car, found := lapTracker.cars[carId]
+	if !found {
+		return nil
+	}
+	var laps []Lap
+	for _, lap := range car.history {
+		if filter(lap) {
+			laps = append(laps, copyStateLap(lap))
+		}
+	}
+	return laps
+}
+
+// BestLap returns the fastest valid lap of the car, ok is false if the car has no valid lap
+func (lapTracker *LapTracker) BestLap(carId uint16) (best Lap, ok bool) {
+	for _, lap := range lapTracker.Laps(carId) {
+		if lap.IsValid && (!ok || lap.LapTimeMs < best.LapTimeMs) {
+			best, ok = lap, true
+		}
+	}
+	return best, ok
+}
+
+// TheoreticalBest returns the sum of the best sector times of the car, over all its laps.
+// The splits of invalid sectors are not taken into account. Ok is false if a sector has no valid time yet.
+func (lapTracker *LapTracker) TheoreticalBest(carId uint16) (lapTimeMs int32, ok bool) {
+	var bestSplits []int32
+	for _, lap := range lapTracker.Laps(carId) {
+		for i, split := range lap.Splits {
+			if i >= len(bestSplits) {
+				bestSplits = append(bestSplits, 0)
+			}
+			if split > 0 && (bestSplits[i] == 0 || split < bestSplits[i]) {
+				bestSplits[i] = split
+			}
+		}
+	}
+	if len(bestSplits) == 0 {
+		return 0, false
+	}
+	for _, split := range bestSplits {
+		if split == 0 {
+			return 0, false
+		}
+		lapTimeMs += split
+	}
+	return lapTimeMs, true
+}
+
+// AverageLap returns the average lap-time over the last n valid laps of the car, not counting in- and out-laps.
+// If the car has less than n such laps, the average over these laps is returned. Count is the number of laps
+// over which the average is taken.
+func (lapTracker *LapTracker) AverageLap(carId uint16, n int) (lapTimeMs int32, count int) {
+	laps := lapTracker.Laps(carId)
+	var sum int64
+	for i := len(laps) - 1; i >= 0 && count < n; i-- {
+		lap := laps[i]
+		if !lap.IsValid || lap.IsInLap || lap.IsOutLap {
+			continue
+		}
+		sum += int64(lap.LapTimeMs)
+		count++
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return int32(sum / int64(count)), count
+}
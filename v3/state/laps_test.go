@@ -0,0 +1,81 @@
+package state_test
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"testing"
+)
+
+func TestLapTracker(t *testing.T) {
+	var completed []state.Lap
+	lapTracker := state.LapTracker{OnLapCompleted: func(lap state.Lap) { completed = append(completed, lap) }}
+	lapTracker.HandleEntryListCar(network.EntryListCar{Id: 3, Drivers: testDrivers})
+
+	update := func(laps uint16, lastLap network.Lap) {
+		lapTracker.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 3, Laps: laps, LastLap: lastLap})
+	}
+	update(0, network.Lap{})
+	update(0, network.Lap{})
+	update(1, network.Lap{LapTimeMs: 130000, Splits: []int32{50000, 40000, 40000}, IsOutLap: 1})
+	update(1, network.Lap{LapTimeMs: 130000, Splits: []int32{50000, 40000, 40000}, IsOutLap: 1})
+	update(2, network.Lap{LapTimeMs: 120000, Splits: []int32{40000, 41000, 39000}})
+	update(3, network.Lap{LapTimeMs: 119000, Splits: []int32{39000, network.InvalidSectorTime, 41000}, IsInvalid: 1})
+	update(4, network.Lap{LapTimeMs: 124000, Splits: []int32{42000, 38000, 44000}, DriverId: 1})
+	update(5, network.Lap{LapTimeMs: 140000, Splits: []int32{42000, 38000, 60000}, DriverId: 1, IsInLap: 1})
+
+	laps := lapTracker.Laps(3)
+	if len(laps) != 5 || len(completed) != 5 {
+		t.Fatalf("expected 5 laps but got %+v", laps)
+	}
+	for i, lap := range laps {
+		if lap.Number != uint16(i+1) {
+			t.Errorf("unexpected number for lap %d: %+v", i, lap)
+		}
+	}
+	if !laps[0].IsOutLap || laps[2].IsValid || !laps[4].IsInLap || laps[3].Driver.ShortName != "BDR" || laps[0].Driver.ShortName != "ADR" {
+		t.Errorf("unexpected laps: %+v", laps)
+	}
+	if laps[2].Splits[1] != 0 {
+		t.Errorf("invalid split not reported as 0: %v", laps[2].Splits)
+	}
+	if driverLaps := lapTracker.DriverLaps(3, 1); len(driverLaps) != 2 {
+		t.Errorf("unexpected laps of driver: %+v", driverLaps)
+	}
+
+	if best, ok := lapTracker.BestLap(3); !ok || best.Number != 2 {
+		t.Errorf("invalid lap taken as best: %+v", best)
+	}
+	if theoretical, ok := lapTracker.TheoreticalBest(3); !ok || theoretical != 39000+38000+39000 {
+		t.Errorf("unexpected theoretical best: %d", theoretical)
+	}
+	if average, count := lapTracker.AverageLap(3, 5); count != 2 || average != 122000 {
+		t.Errorf("unexpected average over %d laps: %d", count, average)
+	}
+	if average, count := lapTracker.AverageLap(3, 1); count != 1 || average != 124000 {
+		t.Errorf("unexpected average over %d laps: %d", count, average)
+	}
+
+	// the lap-completed event records a lap also when the counter does not increment
+	lapTracker.HandleBroadCastEvent(network.BroadCastEvent{Type: network.BroadCastEventTypeLapCompleted, CarId: 3})
+	update(5, network.Lap{LapTimeMs: 118000, Splits: []int32{39000, 40000, 39000}})
+	update(5, network.Lap{LapTimeMs: 118000, Splits: []int32{39000, 40000, 39000}})
+	if laps := lapTracker.Laps(3); len(laps) != 6 || laps[5].Number != 6 || laps[5].LapTimeMs != 118000 {
+		t.Errorf("lap-completed event not taken into account: %+v", laps)
+	}
+
+	// the completed lap remains pending until ACC updates the LastLap
+	update(6, network.Lap{LapTimeMs: 118000, Splits: []int32{39000, 40000, 39000}})
+	update(6, network.Lap{LapTimeMs: 121000, Splits: []int32{40000, 41000, 40000}})
+	lapTracker.HandleBroadCastEvent(network.BroadCastEvent{Type: network.BroadCastEventTypeLapCompleted, CarId: 3})
+	update(6, network.Lap{LapTimeMs: 121000, Splits: []int32{40000, 41000, 40000}})
+	update(6, network.Lap{LapTimeMs: 122000, Splits: []int32{40000, 41000, 41000}})
+	if laps := lapTracker.Laps(3); len(laps) != 8 || laps[6].LapTimeMs != 121000 || laps[7].Number != 8 || laps[7].LapTimeMs != 122000 {
+		t.Errorf("pending lap not recorded once the LastLap changed: %+v", laps)
+	}
+
+	// a new session clears the laps
+	lapTracker.HandleRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 1})
+	if laps := lapTracker.Laps(3); len(laps) != 0 {
+		t.Errorf("laps of previous session kept: %+v", laps)
+	}
+}
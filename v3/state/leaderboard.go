@@ -0,0 +1,263 @@
+package state
+
+import (
+	"fmt"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultSpeedHistory is used when Leaderboard.SpeedHistory is not set
+const DefaultSpeedHistory = 10
+
+// minSpeed (m/s) below which a car is considered standing still and a gap can not be estimated
+const minSpeed = 1.0
+
+// Standing is the position of a car in the leaderboard
+type Standing struct {
+	CarId       uint16
+	RaceNumber  int32
+	CupCategory byte
+	Position    uint16 // overall position, or the position within the cup category for CupStandings
+	Laps        uint16
+
+	// Gap to the leader and Interval to the car ahead, in seconds. Both are 0 for the leader.
+	// The time is estimated from the distance to the other car and the recent speed of this car.
+	// If this car is (nearly) standing still, the gap can not be estimated and GapValid is false.
+	Gap      float64
+	Interval float64
+	GapValid bool
+
+	// LapsToLeader and LapsToAhead are the number of full laps this car is behind, if > 0 the gap is
+	// typically shown as a number of laps instead (see GapString)
+	LapsToLeader int
+	LapsToAhead  int
+}
+
+// GapString returns the gap to the leader as shown on a timing screen, e.g. "+1.234" or "+2 Laps"
+func (standing Standing) GapString() string {
+	return gapString(standing.Position, standing.Gap, standing.LapsToLeader, standing.GapValid)
+}
+
+// IntervalString returns the interval to the car ahead as shown on a timing screen
+func (standing Standing) IntervalString() string {
+	return gapString(standing.Position, standing.Interval, standing.LapsToAhead, standing.GapValid)
+}
+
+func gapString(position uint16, gap float64, laps int, valid bool) string {
+	switch {
+	case position == 1:
+		return ""
+	case laps == 1:
+		return "+1 Lap"
+	case laps > 1:
+		return fmt.Sprintf("+%d Laps", laps)
+	case !valid:
+		return "-"
+	}
+	return fmt.Sprintf("+%.3f", gap)
+}
+
+// Leaderboard computes the gaps between the cars based on their position on track.
+// The cars and their speed history are cleared when a new session starts or when the client disconnects.
+//
+// All methods are safe to be called concurrently. The zero value is ready to use.
+type Leaderboard struct {
+	// SpeedHistory is the number of updates over which the speed of a car is averaged to estimate the gaps,
+	// defaults to DefaultSpeedHistory
+	SpeedHistory int
+
+	mutex        sync.Mutex
+	trackMeters  float64
+	hasUpdate    bool
+	sessionIndex uint16
+	cars         map[uint16]*leaderboardCar
+}
+
+type leaderboardCar struct {
+	entry  network.EntryListCar
+	update network.RealTimeCarUpdate
+	speeds []float64 // m/s, most recent last
+}
+
+// progress returns the number of laps driven including the part of the current lap
+func (car *leaderboardCar) progress() float64 {
+	return float64(car.update.Laps) + float64(car.update.SplinePosition)
+}
+
+func (car *leaderboardCar) averageSpeed() float64 {
+	if len(car.speeds) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, speed := range car.speeds {
+		sum += speed
+	}
+	return sum / float64(len(car.speeds))
+}
+
+// NewLeaderboard returns a Leaderboard that is attached to the client (see Attach)
+func NewLeaderboard(client *network.Client) *Leaderboard {
+	leaderboard := &Leaderboard{}
+	Attach(client, leaderboard)
+	return leaderboard
+}
+
+// HandleTrackData stores the length of the track
+func (leaderboard *Leaderboard) HandleTrackData(trackData network.TrackData) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+	leaderboard.trackMeters = float64(trackData.Meters)
+}
+
+// HandleRealTimeUpdate removes the cars, and thus their speed history, when a new session starts
+func (leaderboard *Leaderboard) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+	if leaderboard.hasUpdate && update.SessionIndex != leaderboard.sessionIndex {
+		leaderboard.cars = nil
+	}
+	leaderboard.sessionIndex = update.SessionIndex
+	leaderboard.hasUpdate = true
+}
+
+// HandleDisconnected removes the cars, they are received again after reconnecting
+func (leaderboard *Leaderboard) HandleDisconnected() {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+	leaderboard.cars = nil
+}
+
+// HandleEntryList removes the cars that are not in the entry-list anymore
+func (leaderboard *Leaderboard) HandleEntryList(entryList network.EntryList) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	cars := make(map[uint16]*leaderboardCar, len(entryList))
+	for _, id := range entryList {
+		if car, found := leaderboard.cars[id]; found {
+			cars[id] = car
+		}
+	}
+	leaderboard.cars = cars
+}
+
+// HandleEntryListCar stores the race-number and cup-category of the car
+func (leaderboard *Leaderboard) HandleEntryListCar(entry network.EntryListCar) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+	leaderboard.car(entry.Id).entry = entry
+}
+
+// HandleRealTimeCarUpdate stores the position and speed of the car
+func (leaderboard *Leaderboard) HandleRealTimeCarUpdate(update network.RealTimeCarUpdate) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	car := leaderboard.car(update.Id)
+	car.update = update
+
+	history := leaderboard.SpeedHistory
+	if history <= 0 {
+		history = DefaultSpeedHistory
+	}
+	car.speeds = append(car.speeds, float64(update.Kmh)/3.6)
+	if len(car.speeds) > history {
+		car.speeds = append(car.speeds[:0], car.speeds[len(car.speeds)-history:]...)
+	}
+}
+
+// car returns the car with the given id, adding it if unknown. The mutex needs to be locked.
+func (leaderboard *Leaderboard) car(id uint16) *leaderboardCar {
+	if leaderboard.cars == nil {
+		leaderboard.cars = make(map[uint16]*leaderboardCar)
+	}
+	car, found := leaderboard.cars[id]
+	if !found {
+		car = &leaderboardCar{entry: network.EntryListCar{Id: id}}
+		leaderboard.cars[id] = car
+	}
+	return car
+}
+
+// Standings returns all cars in order of their overall position
+func (leaderboard *Leaderboard) Standings() []Standing {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	cars := make([]*leaderboardCar, 0, len(leaderboard.cars))
+	for _, car := range leaderboard.cars {
+		cars = append(cars, car)
+	}
+	return leaderboard.standings(cars, func(car *leaderboardCar) uint16 { return car.update.Position })
+}
+
+// CupStandings returns the cars of the given cup-category in order of their position within that category.
+// The gaps are relative to the leader of the category.
+func (leaderboard *Leaderboard) CupStandings(cupCategory byte) []Standing {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	var cars []*leaderboardCar
+	for _, car := range leaderboard.cars {
+		if car.entry.CupCategory == cupCategory {
+			cars = append(cars, car)
+		}
+	}
+	return leaderboard.standings(cars, func(car *leaderboardCar) uint16 { return car.update.CupPosition })
+}
+
+// standings orders the cars by the given position and computes the gaps. The mutex needs to be locked.
+//
+// Cars without a position (e.g. before the start of the session) are put behind the others, in order of
+// their progress on track.
+func (leaderboard *Leaderboard) standings(cars []*leaderboardCar, position func(*leaderboardCar) uint16) []Standing {
+	sort.Slice(cars, func(i, j int) bool {
+		pi, pj := position(cars[i]), position(cars[j])
+		if pi != pj && pi != 0 && pj != 0 {
+			return pi < pj
+		}
+		if (pi == 0) != (pj == 0) {
+			return pj == 0
+		}
+		if cars[i].progress() != cars[j].progress() {
+			return cars[i].progress() > cars[j].progress()
+		}
+		return cars[i].entry.Id < cars[j].entry.Id
+	})
+
+	standings := make([]Standing, len(cars))
+	for i, car := range cars {
+		standing := Standing{
+			CarId:       car.entry.Id,
+			RaceNumber:  car.entry.RaceNumber,
+			CupCategory: car.entry.CupCategory,
+			Position:    uint16(i + 1),
+			Laps:        car.update.Laps,
+			GapValid:    true,
+		}
+		if i > 0 {
+			speed := car.averageSpeed()
+			standing.Gap, standing.LapsToLeader = leaderboard.gap(cars[0], car, speed)
+			standing.Interval, standing.LapsToAhead = leaderboard.gap(cars[i-1], car, speed)
+			standing.GapValid = speed >= minSpeed && leaderboard.trackMeters > 0
+		}
+		standings[i] = standing
+	}
+	return standings
+}
+
+// gap returns the time (in seconds) it takes the car behind, driving at the given speed, to reach the
+// point where the car ahead is now, and the number of full laps it is behind
+func (leaderboard *Leaderboard) gap(ahead *leaderboardCar, behind *leaderboardCar, speed float64) (seconds float64, laps int) {
+	difference := ahead.progress() - behind.progress()
+	if difference <= 0 {
+		return 0, 0
+	}
+	laps = int(math.Floor(difference))
+	if speed < minSpeed || leaderboard.trackMeters <= 0 {
+		return 0, laps
+	}
+	return difference * leaderboard.trackMeters / speed, laps
+}
@@ -0,0 +1,99 @@
+package state_test
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"math"
+	"testing"
+)
+
+func TestLeaderboard(t *testing.T) {
+	var leaderboard state.Leaderboard
+	leaderboard.HandleTrackData(network.TrackData{Meters: 1000})
+	leaderboard.HandleEntryList(network.EntryList{0, 1, 2, 3})
+	leaderboard.HandleEntryListCar(network.EntryListCar{Id: 0, RaceNumber: 10, CupCategory: 0})
+	leaderboard.HandleEntryListCar(network.EntryListCar{Id: 1, RaceNumber: 11, CupCategory: 1})
+	leaderboard.HandleEntryListCar(network.EntryListCar{Id: 2, RaceNumber: 12, CupCategory: 0})
+	leaderboard.HandleEntryListCar(network.EntryListCar{Id: 3, RaceNumber: 13, CupCategory: 1})
+
+	// all cars drive at 36 km/h, thus 10 m/s
+	updates := []network.RealTimeCarUpdate{
+		{Id: 0, Position: 1, CupPosition: 1, Laps: 5, SplinePosition: 0.5, Kmh: 36},
+		{Id: 1, Position: 2, CupPosition: 1, Laps: 5, SplinePosition: 0.4, Kmh: 36},  // 100m behind
+		{Id: 2, Position: 3, CupPosition: 2, Laps: 5, SplinePosition: 0.25, Kmh: 36}, // 150m behind car 1
+		{Id: 3, Position: 4, CupPosition: 2, Laps: 3, SplinePosition: 0.9, Kmh: 36},  // lapped
+	}
+	for _, update := range updates {
+		leaderboard.HandleRealTimeCarUpdate(update)
+	}
+
+	standings := leaderboard.Standings()
+	if len(standings) != 4 {
+		t.Fatalf("unexpected standings: %+v", standings)
+	}
+	for i, expected := range []struct {
+		carId    uint16
+		gap      float64
+		interval float64
+		gapStr   string
+		intStr   string
+	}{
+		{0, 0, 0, "", ""},
+		{1, 10, 10, "+10.000", "+10.000"},
+		{2, 25, 15, "+25.000", "+15.000"},
+		{3, 160, 135, "+1 Lap", "+1 Lap"},
+	} {
+		standing := standings[i]
+		if standing.CarId != expected.carId || standing.Position != uint16(i+1) ||
+			math.Abs(standing.Gap-expected.gap) > 0.01 || math.Abs(standing.Interval-expected.interval) > 0.01 ||
+			standing.GapString() != expected.gapStr || standing.IntervalString() != expected.intStr {
+			t.Errorf("unexpected standing %d: %+v (%s, %s)", i, standing, standing.GapString(), standing.IntervalString())
+		}
+	}
+
+	cup := leaderboard.CupStandings(1)
+	if len(cup) != 2 || cup[0].CarId != 1 || cup[1].CarId != 3 || cup[1].Position != 2 {
+		t.Fatalf("unexpected cup standings: %+v", cup)
+	}
+	if cup[1].LapsToLeader != 1 || math.Abs(cup[1].Gap-150) > 0.01 {
+		t.Errorf("gap not relative to the cup leader: %+v", cup[1])
+	}
+
+	// a car standing still has no gap
+	leaderboard.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 2, Position: 3, Laps: 5, SplinePosition: 0.25})
+	leaderboard.SpeedHistory = 1
+	leaderboard.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 2, Position: 3, Laps: 5, SplinePosition: 0.25})
+	if standing := leaderboard.Standings()[2]; standing.GapValid || standing.GapString() != "-" {
+		t.Errorf("gap estimated for car standing still: %+v", standing)
+	}
+}
+
+func TestLeaderboardReset(t *testing.T) {
+	var client network.Client
+	leaderboard := state.NewLeaderboard(&client)
+
+	client.OnTrackData(network.TrackData{Meters: 1000})
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 1})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 0, Position: 1, Laps: 5, SplinePosition: 0.5, Kmh: 36})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 1, Position: 2, Laps: 5, SplinePosition: 0.4, Kmh: 36})
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 1})
+	if len(leaderboard.Standings()) != 2 {
+		t.Fatal("cars removed while the session did not change")
+	}
+
+	// the speed of the previous session may not be used to estimate the gap of a car standing still
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 2})
+	if standings := leaderboard.Standings(); len(standings) != 0 {
+		t.Errorf("cars of the previous session kept: %+v", standings)
+	}
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 0, Position: 1, SplinePosition: 0.2})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 1, Position: 2, SplinePosition: 0.1})
+	if standing := leaderboard.Standings()[1]; standing.GapValid {
+		t.Errorf("gap estimated with the speed of the previous session: %+v", standing)
+	}
+
+	client.OnDisconnected()
+	if standings := leaderboard.Standings(); len(standings) != 0 {
+		t.Errorf("cars kept after disconnecting: %+v", standings)
+	}
+}
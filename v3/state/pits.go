@@ -0,0 +1,222 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"sync"
+)
+
+// Stint is the time a car spent on track between two visits to the pit-lane
+type Stint struct {
+	CarId              uint16
+	DriverId           uint16  // index in EntryListCar.Drivers of the driver at the start of the stint
+	StartSessionTimeMs float32 // session-time at which the car left the pit-lane (or was first seen on track)
+	StartLaps          uint16  // Laps counter at the start of the stint
+	Laps               uint16  // laps completed during the stint
+	TimeMs             float32 // duration of the stint
+}
+
+// PitIn is the moment a car enters the pit-lane
+type PitIn struct {
+	CarId          uint16
+	SessionTimeMs  float32
+	SplinePosition float32
+	Laps           uint16 // Laps counter when entering the pit-lane
+	DriverId       uint16 // index in EntryListCar.Drivers of the driver entering the pit-lane
+	Stint          Stint  // the stint that ended by entering the pit-lane
+}
+
+// PitOut is the moment a car leaves the pit-lane
+type PitOut struct {
+	CarId          uint16
+	SessionTimeMs  float32
+	SplinePosition float32
+	PitLaneTimeMs  float32 // time between PitIn and PitOut
+
+	// DriverSwap is true if the driver entering the pit-lane is not the one leaving it
+	DriverSwap       bool
+	PreviousDriverId uint16
+	DriverId         uint16
+}
+
+// PitStop combines the PitIn with the corresponding PitOut.
+// As long as the car is still in the pit-lane, Completed is false and Out is not valid.
+type PitStop struct {
+	In        PitIn
+	Out       PitOut
+	Completed bool
+}
+
+// PitTracker detects pit-stops and stints based on the CarLocation of the cars.
+//
+// As CarLocationPitEntry is only seen briefly (or not at all), the car is considered in the pit-lane as of the
+// first update with CarLocationPitEntry or CarLocationPitlane and out of the pit-lane as of the first update with
+// CarLocationPitExit or CarLocationTrack. The time of the RealTimeUpdate preceding the car update is used as
+// the time of these transitions. Cars that are in the pit-lane when first seen (e.g. at the start of a
+// practice session) do not result in a PitIn, but do result in a PitOut once they leave.
+//
+// The pit-stops are cleared when a new session starts. All methods are safe to be called concurrently.
+// The zero value is ready to use.
+type PitTracker struct {
+	OnPitIn  func(PitIn)
+	OnPitOut func(PitOut)
+
+	mutex         sync.Mutex
+	sessionIndex  uint16
+	sessionTimeMs float32
+	cars          map[uint16]*pitCar
+}
+
+type pitCar struct {
+	hasUpdate bool
+	inPitLane bool
+	stint     Stint
+	hasStint  bool
+	stops     []PitStop
+}
+
+// NewPitTracker returns a PitTracker that is attached to the client (see Attach)
+func NewPitTracker(client *network.Client) *PitTracker {
+	pitTracker := &PitTracker{}
+	Attach(client, pitTracker)
+	return pitTracker
+}
+
+// HandleRealTimeUpdate keeps track of the session-time and clears all pit-stops when a new session starts
+func (pitTracker *PitTracker) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	pitTracker.mutex.Lock()
+	defer pitTracker.mutex.Unlock()
+
+	pitTracker.sessionTimeMs = update.SessionTime
+	if update.SessionIndex != pitTracker.sessionIndex {
+		pitTracker.sessionIndex = update.SessionIndex
+		pitTracker.cars = nil
+	}
+}
+
+// HandleRealTimeCarUpdate detects the car entering or leaving the pit-lane
+func (pitTracker *PitTracker) HandleRealTimeCarUpdate(update network.RealTimeCarUpdate) {
+	pitIn, pitOut := pitTracker.update(update)
+	if pitIn != nil && pitTracker.OnPitIn != nil {
+		pitTracker.OnPitIn(*pitIn)
+	}
+	if pitOut != nil && pitTracker.OnPitOut != nil {
+		pitTracker.OnPitOut(*pitOut)
+	}
+}
+
+func (pitTracker *PitTracker) update(update network.RealTimeCarUpdate) (pitIn *PitIn, pitOut *PitOut) {
+	pitTracker.mutex.Lock()
+	defer pitTracker.mutex.Unlock()
+
+	var inPitLane bool
+	switch update.CarLocation {
+	case network.CarLocationPitEntry, network.CarLocationPitlane:
+		inPitLane = true
+	case network.CarLocationTrack, network.CarLocationPitExit:
+		inPitLane = false
+	default:
+		return nil, nil
+	}
+
+	if pitTracker.cars == nil {
+		pitTracker.cars = make(map[uint16]*pitCar)
+	}
+	car, found := pitTracker.cars[update.Id]
+	if !found {
+		car = &pitCar{}
+		pitTracker.cars[update.Id] = car
+	}
+	now := pitTracker.sessionTimeMs
+
+	if car.hasStint && update.Laps >= car.stint.StartLaps {
+		car.stint.Laps = update.Laps - car.stint.StartLaps
+		car.stint.TimeMs = now - car.stint.StartSessionTimeMs
+	}
+
+	switch {
+	case !car.hasUpdate:
+		if !inPitLane {
+			car.startStint(update, now)
+		}
+
+	case inPitLane && !car.inPitLane:
+		pitIn = &PitIn{
+			CarId:          update.Id,
+			SessionTimeMs:  now,
+			SplinePosition: update.SplinePosition,
+			Laps:           update.Laps,
+			DriverId:       update.DriverId,
+			Stint:          car.stint,
+		}
+		if !car.hasStint {
+			pitIn.Stint = Stint{CarId: update.Id, DriverId: update.DriverId}
+		}
+		car.hasStint = false
+		car.stops = append(car.stops, PitStop{In: *pitIn})
+
+	case !inPitLane && car.inPitLane:
+		pitOut = &PitOut{
+			CarId:            update.Id,
+			SessionTimeMs:    now,
+			SplinePosition:   update.SplinePosition,
+			PreviousDriverId: update.DriverId,
+			DriverId:         update.DriverId,
+		}
+		if n := len(car.stops); n > 0 && !car.stops[n-1].Completed {
+			stop := &car.stops[n-1]
+			pitOut.PitLaneTimeMs = now - stop.In.SessionTimeMs
+			pitOut.PreviousDriverId = stop.In.DriverId
+			pitOut.DriverSwap = pitOut.PreviousDriverId != update.DriverId
+			stop.Out = *pitOut
+			stop.Completed = true
+		}
+		car.startStint(update, now)
+	}
+
+	car.hasUpdate = true
+	car.inPitLane = inPitLane
+	return pitIn, pitOut
+}
+
+func (car *pitCar) startStint(update network.RealTimeCarUpdate, now float32) {
+	car.stint = Stint{
+		CarId:              update.Id,
+		DriverId:           update.DriverId,
+		StartSessionTimeMs: now,
+		StartLaps:          update.Laps,
+	}
+	car.hasStint = true
+}
+
+// PitStops returns the pit-stops of the car in the current session, including the ongoing one
+func (pitTracker *PitTracker) PitStops(carId uint16) []PitStop {
+	pitTracker.mutex.Lock()
+	defer pitTracker.mutex.Unlock()
+
+	car, found := pitTracker.cars[carId]
+	if !found {
+		return nil
+	}
+	return append([]PitStop(nil), car.stops...)
+}
+
+// Stint returns the ongoing stint of the car, ok is false if the car is in the pit-lane
+func (pitTracker *PitTracker) Stint(carId uint16) (stint Stint, ok bool) {
+	pitTracker.mutex.Lock()
+	defer pitTracker.mutex.Unlock()
+
+	car, found := pitTracker.cars[carId]
+	if !found || !car.hasStint {
+		return stint, false
+	}
+	return car.stint, true
+}
+
+// InPitLane returns true if the car is currently in the pit-lane
+func (pitTracker *PitTracker) InPitLane(carId uint16) bool {
+	pitTracker.mutex.Lock()
+	defer pitTracker.mutex.Unlock()
+
+	car, found := pitTracker.cars[carId]
+	return found && car.inPitLane
+}
@@ -0,0 +1,65 @@
+package state_test
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"testing"
+)
+
+func TestPitTracker(t *testing.T) {
+	var pitIns []state.PitIn
+	var pitOuts []state.PitOut
+	pitTracker := state.PitTracker{
+		OnPitIn:  func(pitIn state.PitIn) { pitIns = append(pitIns, pitIn) },
+		OnPitOut: func(pitOut state.PitOut) { pitOuts = append(pitOuts, pitOut) },
+	}
+
+	update := func(sessionTimeMs float32, location uint8, laps uint16, driverId uint16) {
+		pitTracker.HandleRealTimeUpdate(network.RealTimeUpdate{SessionTime: sessionTimeMs})
+		pitTracker.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 1, CarLocation: location, Laps: laps, DriverId: driverId})
+	}
+
+	// starting in the pit-lane does not result in a pit-in
+	update(0, network.CarLocationPitlane, 0, 0)
+	update(1000, network.CarLocationPitExit, 0, 0)
+	update(2000, network.CarLocationTrack, 0, 0)
+	update(600000, network.CarLocationTrack, 5, 0)
+	if len(pitIns) != 0 || len(pitOuts) != 1 || pitOuts[0].DriverSwap {
+		t.Fatalf("unexpected pit events when starting in the pit-lane: %+v, %+v", pitIns, pitOuts)
+	}
+	if stint, ok := pitTracker.Stint(1); !ok || stint.Laps != 5 || stint.TimeMs != 599000 {
+		t.Errorf("unexpected stint: %+v", stint)
+	}
+
+	update(610000, network.CarLocationPitEntry, 5, 0)
+	update(615000, network.CarLocationPitlane, 5, 0)
+	if len(pitIns) != 1 || pitIns[0].SessionTimeMs != 610000 || pitIns[0].Stint.Laps != 5 || pitIns[0].Stint.TimeMs != 609000 {
+		t.Fatalf("unexpected pit-in: %+v", pitIns)
+	}
+	if _, ok := pitTracker.Stint(1); ok || !pitTracker.InPitLane(1) {
+		t.Error("car in pit-lane still has a stint")
+	}
+
+	update(670000, network.CarLocationPitlane, 6, 1)
+	update(672000, network.CarLocationTrack, 6, 1)
+	if len(pitOuts) != 2 || pitOuts[1].PitLaneTimeMs != 62000 || !pitOuts[1].DriverSwap || pitOuts[1].PreviousDriverId != 0 {
+		t.Fatalf("unexpected pit-out: %+v", pitOuts)
+	}
+	if stops := pitTracker.PitStops(1); len(stops) != 1 || !stops[0].Completed || stops[0].Out.DriverId != 1 {
+		t.Errorf("unexpected pit-stops: %+v", stops)
+	}
+	if stint, ok := pitTracker.Stint(1); !ok || stint.DriverId != 1 || stint.StartLaps != 6 {
+		t.Errorf("new stint not started: %+v", stint)
+	}
+
+	// the driver entering the pit-lane is compared, not the driver that started the stint
+	update(700000, network.CarLocationTrack, 7, 0)
+	update(710000, network.CarLocationPitlane, 7, 0)
+	update(740000, network.CarLocationTrack, 7, 0)
+	if len(pitIns) != 2 || pitIns[1].DriverId != 0 || pitIns[1].Stint.DriverId != 1 {
+		t.Fatalf("unexpected pit-in: %+v", pitIns)
+	}
+	if len(pitOuts) != 3 || pitOuts[2].DriverSwap || pitOuts[2].PreviousDriverId != 0 {
+		t.Errorf("unexpected pit-out: %+v", pitOuts)
+	}
+}
@@ -0,0 +1,216 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"sort"
+	"sync"
+)
+
+// Weather as reported in the RealTimeUpdate
+type Weather struct {
+	AmbientTemp int8 // degrees Celsius
+	TrackTemp   int8 // degrees Celsius
+	Clouds      byte
+	RainLevel   byte
+	Wetness     byte
+}
+
+// Car joins the info from the entry-list with the latest update of the car
+type Car struct {
+	Id uint16
+
+	// Entry is only valid if HasEntry, the EntryListCar might not be received yet for cars that just joined
+	Entry    network.EntryListCar
+	HasEntry bool
+
+	// Update is only valid if HasUpdate
+	Update    network.RealTimeCarUpdate
+	HasUpdate bool
+}
+
+// Driver returns the driver currently driving the car.
+// The DriverId of the latest update is used if available, otherwise the CurrentDriverId of the entry-list.
+func (car Car) Driver() (driver network.Driver, ok bool) {
+	if !car.HasEntry {
+		return driver, false
+	}
+	index := int(car.Entry.CurrentDriverId)
+	if car.HasUpdate {
+		index = int(car.Update.DriverId)
+	}
+	if index < 0 || index >= len(car.Entry.Drivers) {
+		return driver, false
+	}
+	return car.Entry.Drivers[index], true
+}
+
+// Snapshot is a copy of the state of the Session at a given moment.
+// It does not share any memory with the Session, thus it can be kept and modified freely.
+type Snapshot struct {
+	// Track is only valid if HasTrack
+	Track    network.TrackData
+	HasTrack bool
+
+	SessionIndex uint16
+	SessionType  byte // see network.SessionType<name> constants
+	Phase        byte // see network.SessionPhase<name> constants
+	Weather      Weather
+
+	// Update is the most recent RealTimeUpdate, containing also the session-time, the focused car etc.
+	Update network.RealTimeUpdate
+
+	// Cars in the entry-list and the cars for which updates are received, sorted by Id
+	Cars []Car
+}
+
+// Car returns the car with the given id
+func (snapshot Snapshot) Car(id uint16) (car Car, ok bool) {
+	i := sort.Search(len(snapshot.Cars), func(i int) bool { return snapshot.Cars[i].Id >= id })
+	if i < len(snapshot.Cars) && snapshot.Cars[i].Id == id {
+		return snapshot.Cars[i], true
+	}
+	return car, false
+}
+
+// Session keeps the most recent state of the session as received by a network.Client.
+//
+// All methods are safe to be called concurrently, thus the state can be read while the Client is feeding it.
+// The zero value is an empty Session ready to use.
+type Session struct {
+	mutex sync.RWMutex
+
+	track     network.TrackData
+	hasTrack  bool
+	update    network.RealTimeUpdate
+	hasUpdate bool
+	cars      map[uint16]*Car
+}
+
+// NewSession returns a Session that is attached to the client (see Attach)
+func NewSession(client *network.Client) *Session {
+	session := &Session{}
+	Attach(client, session)
+	return session
+}
+
+// HandleTrackData stores the track-data
+func (session *Session) HandleTrackData(trackData network.TrackData) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.track = copyTrackData(trackData)
+	session.hasTrack = true
+}
+
+// HandleRealTimeUpdate stores the most recent session info.
+// When a new session starts, the cars are removed as the entry-list might have changed (see HandleEntryList).
+func (session *Session) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.hasUpdate && update.SessionIndex != session.update.SessionIndex {
+		session.cars = nil
+	}
+	session.update = copyRealTimeUpdate(update)
+	session.hasUpdate = true
+}
+
+// HandleDisconnected removes the cars, they are received again after reconnecting
+func (session *Session) HandleDisconnected() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.cars = nil
+}
+
+// HandleEntryList removes the cars that are not in the entry-list anymore
+func (session *Session) HandleEntryList(entryList network.EntryList) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	cars := make(map[uint16]*Car, len(entryList))
+	for _, id := range entryList {
+		if car, found := session.cars[id]; found {
+			cars[id] = car
+		} else {
+			cars[id] = &Car{Id: id}
+		}
+	}
+	session.cars = cars
+}
+
+// HandleEntryListCar stores the entry info of the car
+func (session *Session) HandleEntryListCar(entry network.EntryListCar) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	car := session.car(entry.Id)
+	car.Entry = copyEntryListCar(entry)
+	car.HasEntry = true
+}
+
+// HandleRealTimeCarUpdate stores the latest update of the car
+func (session *Session) HandleRealTimeCarUpdate(update network.RealTimeCarUpdate) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	car := session.car(update.Id)
+	car.Update = copyRealTimeCarUpdate(update)
+	car.HasUpdate = true
+}
+
+// car returns the car with the given id, adding it if unknown. The mutex needs to be locked.
+func (session *Session) car(id uint16) *Car {
+	if session.cars == nil {
+		session.cars = make(map[uint16]*Car)
+	}
+	car, found := session.cars[id]
+	if !found {
+		car = &Car{Id: id}
+		session.cars[id] = car
+	}
+	return car
+}
+
+// Snapshot returns a copy of the current state
+func (session *Session) Snapshot() Snapshot {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	snapshot := Snapshot{
+		Track:        copyTrackData(session.track),
+		HasTrack:     session.hasTrack,
+		SessionIndex: session.update.SessionIndex,
+		SessionType:  session.update.SessionType,
+		Phase:        session.update.Phase,
+		Weather: Weather{
+			AmbientTemp: session.update.AmbientTemp,
+			TrackTemp:   session.update.TrackTemp,
+			Clouds:      session.update.Clouds,
+			RainLevel:   session.update.RainLevel,
+			Wetness:     session.update.Wettness,
+		},
+		Update: copyRealTimeUpdate(session.update),
+		Cars:   make([]Car, 0, len(session.cars)),
+	}
+	for _, car := range session.cars {
+		snapshot.Cars = append(snapshot.Cars, copyCar(*car))
+	}
+	sort.Slice(snapshot.Cars, func(i, j int) bool { return snapshot.Cars[i].Id < snapshot.Cars[j].Id })
+	return snapshot
+}
+
+// Car returns a copy of the car with the given id
+func (session *Session) Car(id uint16) (car Car, ok bool) {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	if c, found := session.cars[id]; found {
+		return copyCar(*c), true
+	}
+	return car, false
+}
+
+// Track returns a copy of the track-data, ok is false if no track-data is received yet
+func (session *Session) Track() (trackData network.TrackData, ok bool) {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return copyTrackData(session.track), session.hasTrack
+}
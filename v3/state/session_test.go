@@ -0,0 +1,135 @@
+package state_test
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"sync"
+	"testing"
+)
+
+var testDrivers = []network.Driver{
+	{FirstName: "A", LastName: "Driver", ShortName: "ADR"},
+	{FirstName: "B", LastName: "Driver", ShortName: "BDR"},
+}
+
+func TestSession(t *testing.T) {
+	userCalled := false
+	var session *state.Session
+	client := network.Client{OnEntryListCar: func(car network.EntryListCar) {
+		if _, ok := session.Car(car.Id); !ok {
+			t.Error("session not updated before the callback of the client")
+		}
+		userCalled = true
+	}}
+	session = state.NewSession(&client)
+
+	client.OnTrackData(network.TrackData{Name: network.TrackNameSpa, Meters: 7004, CameraSets: map[string][]string{"set": {"cam"}}})
+	client.OnEntryList(network.EntryList{0, 1})
+	client.OnEntryListCar(network.EntryListCar{Id: 0, RaceNumber: 7, CurrentDriverId: 0, Drivers: testDrivers})
+	client.OnEntryListCar(network.EntryListCar{Id: 1, RaceNumber: 12, Drivers: testDrivers[:1]})
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionType: network.SessionTypeRace, Phase: network.SessionPhaseSession, TrackTemp: 24, Wettness: 2})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 0, DriverId: 1, Position: 1, LastLap: network.Lap{Splits: []int32{1, 2, 3}}})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 2, Position: 2})
+
+	if !userCalled {
+		t.Error("callback of the client not called anymore")
+	}
+
+	snapshot := session.Snapshot()
+	if !snapshot.HasTrack || snapshot.Track.Meters != 7004 {
+		t.Errorf("unexpected track: %+v", snapshot.Track)
+	}
+	if snapshot.SessionType != network.SessionTypeRace || snapshot.Phase != network.SessionPhaseSession {
+		t.Errorf("unexpected session: %+v", snapshot)
+	}
+	if snapshot.Weather.TrackTemp != 24 || snapshot.Weather.Wetness != 2 {
+		t.Errorf("unexpected weather: %+v", snapshot.Weather)
+	}
+	if len(snapshot.Cars) != 3 || snapshot.Cars[0].Id != 0 || snapshot.Cars[1].Id != 1 || snapshot.Cars[2].Id != 2 {
+		t.Fatalf("unexpected cars: %+v", snapshot.Cars)
+	}
+
+	car, ok := snapshot.Car(0)
+	if !ok || !car.HasEntry || !car.HasUpdate || car.Entry.RaceNumber != 7 || car.Update.Position != 1 {
+		t.Errorf("entry and update not joined: %+v", car)
+	}
+	if driver, ok := car.Driver(); !ok || driver.ShortName != "BDR" {
+		t.Errorf("current driver not taken from the update: %+v", driver)
+	}
+	if driver, ok := snapshot.Cars[1].Driver(); !ok || driver.ShortName != "ADR" {
+		t.Errorf("current driver not taken from the entry-list: %+v", driver)
+	}
+	if car := snapshot.Cars[2]; car.HasEntry || !car.HasUpdate {
+		t.Errorf("car without entry: %+v", car)
+	}
+
+	// modifying the snapshot should not modify the session
+	snapshot.Cars[0].Entry.Drivers[0].ShortName = "XXX"
+	snapshot.Cars[0].Update.LastLap.Splits[0] = 99
+	snapshot.Track.CameraSets["set"][0] = "other"
+	again := session.Snapshot()
+	if again.Cars[0].Entry.Drivers[0].ShortName != "ADR" || again.Cars[0].Update.LastLap.Splits[0] != 1 || again.Track.CameraSets["set"][0] != "cam" {
+		t.Error("snapshot shares memory with the session")
+	}
+
+	// modifying what was handled should not modify the session either
+	drivers := append([]network.Driver(nil), testDrivers...)
+	session.HandleEntryListCar(network.EntryListCar{Id: 0, RaceNumber: 7, Drivers: drivers})
+	drivers[0].ShortName = "XXX"
+	if car, _ := session.Car(0); car.Entry.Drivers[0].ShortName != "ADR" {
+		t.Error("session shares the drivers with the handled entry")
+	}
+
+	// a new entry-list removes the cars that left
+	client.OnEntryList(network.EntryList{0})
+	if _, ok := session.Car(1); ok {
+		t.Error("car not in the entry-list anymore is still in the session")
+	}
+	if car, ok := session.Car(0); !ok || !car.HasEntry {
+		t.Error("car still in the entry-list lost its entry")
+	}
+}
+
+func TestSessionReset(t *testing.T) {
+	var client network.Client
+	session := state.NewSession(&client)
+
+	client.OnEntryList(network.EntryList{0, 1})
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 1})
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 0})
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 1})
+	if len(session.Snapshot().Cars) != 2 {
+		t.Fatal("cars removed while the session did not change")
+	}
+
+	client.OnRealTimeUpdate(network.RealTimeUpdate{SessionIndex: 2})
+	if cars := session.Snapshot().Cars; len(cars) != 0 {
+		t.Errorf("cars of the previous session kept: %+v", cars)
+	}
+
+	client.OnRealTimeCarUpdate(network.RealTimeCarUpdate{Id: 1})
+	client.OnDisconnected()
+	if cars := session.Snapshot().Cars; len(cars) != 0 {
+		t.Errorf("cars kept after disconnecting: %+v", cars)
+	}
+}
+
+func TestSessionConcurrentSnapshots(t *testing.T) {
+	var session state.Session
+	session.HandleEntryList(network.EntryList{0, 1})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			session.HandleRealTimeCarUpdate(network.RealTimeCarUpdate{Id: uint16(i % 2), Laps: uint16(i)})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		for _, car := range session.Snapshot().Cars {
+			_ = car.Update.Laps
+		}
+	}
+	wg.Wait()
+}
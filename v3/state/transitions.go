@@ -0,0 +1,116 @@
+package state
+
+import (
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"sync"
+)
+
+// SessionTracker derives the transitions of the session from the RealTimeUpdate's, as ACC never sends out
+// BroadCastEventTypeGreenFlag and BroadCastEventTypeSessionOver.
+//
+// The callbacks receive the RealTimeUpdate in which the transition was detected. A new session is detected by a
+// change of SessionIndex or SessionType. The first RealTimeUpdate after connecting results in OnSessionStarted
+// and OnPhaseChanged (from SessionPhaseNONE) but not in OnGreenFlag, OnSessionOver or OnResults as the
+// transition most probably happened before connecting.
+//
+// All methods are safe to be called concurrently. The zero value is ready to use.
+type SessionTracker struct {
+	// OnSessionStarted is called when a new session is detected
+	OnSessionStarted func(update network.RealTimeUpdate)
+
+	// OnPhaseChanged is called whenever the Phase changes, with the phases as defined by network.SessionPhase<name>
+	OnPhaseChanged func(previous byte, phase byte, update network.RealTimeUpdate)
+
+	// OnGreenFlag is called when the phase reaches SessionPhaseSession
+	OnGreenFlag func(update network.RealTimeUpdate)
+
+	// OnSessionOver is called when the phase reaches SessionPhaseSessionOver (the chequered flag)
+	OnSessionOver func(update network.RealTimeUpdate)
+
+	// OnResults is called when the phase reaches SessionPhaseResultUI
+	OnResults func(update network.RealTimeUpdate)
+
+	mutex        sync.Mutex
+	hasUpdate    bool
+	sessionIndex uint16
+	sessionType  byte
+	phase        byte
+}
+
+// NewSessionTracker returns a SessionTracker that is attached to the client (see Attach)
+func NewSessionTracker(client *network.Client) *SessionTracker {
+	sessionTracker := &SessionTracker{}
+	Attach(client, sessionTracker)
+	return sessionTracker
+}
+
+// transitions detected in a RealTimeUpdate
+type transitions struct {
+	started       bool
+	phaseChanged  bool
+	previousPhase byte
+	greenFlag     bool
+	sessionOver   bool
+	results       bool
+}
+
+// HandleRealTimeUpdate detects the transitions and calls the corresponding callbacks
+func (sessionTracker *SessionTracker) HandleRealTimeUpdate(update network.RealTimeUpdate) {
+	t := sessionTracker.update(update)
+
+	if t.started && sessionTracker.OnSessionStarted != nil {
+		sessionTracker.OnSessionStarted(update)
+	}
+	if t.phaseChanged && sessionTracker.OnPhaseChanged != nil {
+		sessionTracker.OnPhaseChanged(t.previousPhase, update.Phase, update)
+	}
+	if t.greenFlag && sessionTracker.OnGreenFlag != nil {
+		sessionTracker.OnGreenFlag(update)
+	}
+	if t.sessionOver && sessionTracker.OnSessionOver != nil {
+		sessionTracker.OnSessionOver(update)
+	}
+	if t.results && sessionTracker.OnResults != nil {
+		sessionTracker.OnResults(update)
+	}
+}
+
+func (sessionTracker *SessionTracker) update(update network.RealTimeUpdate) (t transitions) {
+	sessionTracker.mutex.Lock()
+	defer sessionTracker.mutex.Unlock()
+
+	hadUpdate := sessionTracker.hasUpdate
+	t.previousPhase = sessionTracker.phase
+	t.started = !hadUpdate || update.SessionIndex != sessionTracker.sessionIndex || update.SessionType != sessionTracker.sessionType
+	t.phaseChanged = update.Phase != sessionTracker.phase
+
+	// phases are compared to the start of a new session, as the previous session most probably ended with a
+	// phase beyond the phase of the new session
+	reference := sessionTracker.phase
+	if t.started {
+		reference = network.SessionPhaseNONE
+	}
+	if hadUpdate {
+		t.greenFlag = crossed(reference, update.Phase, network.SessionPhaseSession)
+		t.sessionOver = crossed(reference, update.Phase, network.SessionPhaseSessionOver)
+		t.results = crossed(reference, update.Phase, network.SessionPhaseResultUI)
+	}
+
+	sessionTracker.hasUpdate = true
+	sessionTracker.sessionIndex = update.SessionIndex
+	sessionTracker.sessionType = update.SessionType
+	sessionTracker.phase = update.Phase
+	return t
+}
+
+// crossed returns true if going from phase previous to phase reaches (or skips over) the given phase
+func crossed(previous byte, phase byte, reached byte) bool {
+	return previous < reached && phase >= reached
+}
+
+// Phase returns the current phase of the session, see network.SessionPhase<name>
+func (sessionTracker *SessionTracker) Phase() byte {
+	sessionTracker.mutex.Lock()
+	defer sessionTracker.mutex.Unlock()
+	return sessionTracker.phase
+}
@@ -0,0 +1,56 @@
+package state_test
+
+import (
+	"fmt"
+	"github.com/toonknapen/accbroadcastingsdk/v3/network"
+	"github.com/toonknapen/accbroadcastingsdk/v3/state"
+	"reflect"
+	"testing"
+)
+
+func TestSessionTracker(t *testing.T) {
+	var events []string
+	sessionTracker := state.SessionTracker{
+		OnSessionStarted: func(update network.RealTimeUpdate) {
+			events = append(events, fmt.Sprintf("started %d", update.SessionType))
+		},
+		OnPhaseChanged: func(previous byte, phase byte, update network.RealTimeUpdate) {
+			events = append(events, fmt.Sprintf("phase %d->%d", previous, phase))
+		},
+		OnGreenFlag:   func(network.RealTimeUpdate) { events = append(events, "green") },
+		OnSessionOver: func(network.RealTimeUpdate) { events = append(events, "over") },
+		OnResults:     func(network.RealTimeUpdate) { events = append(events, "results") },
+	}
+
+	updates := []network.RealTimeUpdate{
+		// connecting during qualifying
+		{SessionIndex: 0, SessionType: network.SessionTypeQualifying, Phase: network.SessionPhaseSession},
+		{SessionIndex: 0, SessionType: network.SessionTypeQualifying, Phase: network.SessionPhaseSession},
+		{SessionIndex: 0, SessionType: network.SessionTypeQualifying, Phase: network.SessionPhasePostSession},
+		{SessionIndex: 0, SessionType: network.SessionTypeQualifying, Phase: network.SessionPhaseResultUI},
+		// race
+		{SessionIndex: 1, SessionType: network.SessionTypeRace, Phase: network.SessionPhaseStarting},
+		{SessionIndex: 1, SessionType: network.SessionTypeRace, Phase: network.SessionPhaseFormationLap},
+		{SessionIndex: 1, SessionType: network.SessionTypeRace, Phase: network.SessionPhaseSession},
+		{SessionIndex: 1, SessionType: network.SessionTypeRace, Phase: network.SessionPhaseSessionOver},
+	}
+	for _, update := range updates {
+		sessionTracker.HandleRealTimeUpdate(update)
+	}
+
+	expected := []string{
+		"started 4", "phase 0->5",
+		"phase 5->7", "over",
+		"phase 7->8", "results",
+		"started 10", "phase 8->1",
+		"phase 1->3",
+		"phase 3->5", "green",
+		"phase 5->6", "over",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events:\n%v\nexpected:\n%v", events, expected)
+	}
+	if sessionTracker.Phase() != network.SessionPhaseSessionOver {
+		t.Errorf("unexpected phase %d", sessionTracker.Phase())
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/toonknapen/accbroadcastingsdk/v3/network"
@@ -8,61 +9,46 @@ import (
 	"time"
 )
 
-var connectedStream chan int32
-var sessionTimeStream chan float32
-var disconnectedStream chan int32
-
-func OnConnected(connectionId int32) {
-	log.Info().Msgf("OnConnected: id=%d", connectionId)
-	connectedStream <- connectionId
-}
-
-func OnRealTimeUpdate(realTimeUpdate network.RealTimeUpdate) {
-	log.Info().Msgf("RealTimeUpdate %f", realTimeUpdate.SessionTime)
-	sessionTimeStream <- realTimeUpdate.SessionTime
-}
-
-func OnDisconnected() {
-	log.Info().Msg("OnDisconnected")
-	disconnectedStream <- 0
-}
-
 func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true, TimeFormat: zerolog.TimeFieldFormat})
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 
-	connectedStream = make(chan int32)
-	sessionTimeStream = make(chan float32, 100)
-	disconnectedStream = make(chan int32)
-
 	accClient := network.Client{
-		OnConnected:      OnConnected,
-		OnDisconnected:   OnDisconnected,
-		OnRealTimeUpdate: OnRealTimeUpdate,
+		EventBufferSize: 100,
+		EventOverflow:   network.OverflowDropOldest,
 	}
-
-	// network.SetupCloseHandler(&accClient)
+	events := accClient.Events()
 
 	for i := 0; i < 30; i++ {
 		log.Info().Msgf("main loop going to connect")
-		go accClient.ConnectListenAndCallback("127.0.0.1:9000", "pitwall", "asd", 250, "", 5000)
-
-		connectionId := <-connectedStream
-		log.Info().Msgf("main loop Connected: %d", connectionId)
-
-		for i := 0; i < 5; i++ {
-			<-sessionTimeStream
+		ctx, cancel := context.WithCancel(context.Background())
+		go accClient.Run(ctx, network.Config{
+			Address:                  "127.0.0.1:9000",
+			DisplayName:              "pitwall",
+			ConnectionPassword:       "asd",
+			RealtimeUpdateIntervalMs: 250,
+			TimeoutMs:                5000,
+		})
+
+		realTimeUpdates := 0
+		for realTimeUpdates < 5 {
+			switch event := (<-events).(type) {
+			case network.Connected:
+				log.Info().Msgf("main loop Connected: %d", event.ConnectionId)
+			case network.RealTimeUpdate:
+				log.Info().Msgf("RealTimeUpdate %f", event.SessionTime)
+				realTimeUpdates++
+			}
 		}
 
 		log.Info().Msgf("main loop requesting to disconnect")
-		accClient.RequestDisconnect()
-		<-disconnectedStream
-		log.Info().Msgf("main loop DisConnected")
-
-		log.Info().Msgf("length sessionTimeStream %d", len(sessionTimeStream))
-		for len(sessionTimeStream) > 0 {
-			<-sessionTimeStream
+		cancel()
+		for event := range events {
+			if _, ok := event.(network.Disconnected); ok {
+				break
+			}
 		}
+		log.Info().Msgf("main loop DisConnected")
 
 		waitSeconds := 1
 		log.Info().Msgf("waiting for %d seconds", waitSeconds)